@@ -3,12 +3,15 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // This is a struct that gets only what
@@ -56,6 +59,10 @@ type userNotification interface {
 	sendUserMessage(ctx context.Context, botPassword, user, message string) error
 }
 
+type streamLister interface {
+	listStreams(ctx context.Context, botPassword string) ([]string, error)
+}
+
 // implements userRequest
 type zulipUserRequest struct {
 	json incomingJSON
@@ -96,6 +103,62 @@ func (zun *zulipUserNotification) sendUserMessage(ctx context.Context, botPasswo
 	return nil
 }
 
+// streams don't change often, so they're only fetched from zulip this often
+const streamsCacheTime = time.Hour
+
+// implements streamLister
+type zulipStreamLister struct {
+	botUsername string
+	zulipAPIURL string
+
+	mu      sync.Mutex
+	streams []string
+	fetched time.Time
+}
+
+func (zsl *zulipStreamLister) listStreams(ctx context.Context, botPassword string) ([]string, error) {
+	zsl.mu.Lock()
+	defer zsl.mu.Unlock()
+	if zsl.streams != nil && time.Since(zsl.fetched) < streamsCacheTime {
+		return zsl.streams, nil
+	}
+
+	zulipClient := &http.Client{}
+	req, err := http.NewRequestWithContext(ctx, "GET", zsl.zulipAPIURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(zsl.botUsername, botPassword)
+
+	resp, err := zulipClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var streamsResp struct {
+		Result  string `json:"result"`
+		Msg     string `json:"msg"`
+		Streams []struct {
+			Name string `json:"name"`
+		} `json:"streams"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&streamsResp); err != nil {
+		return nil, err
+	}
+	if streamsResp.Result != "success" {
+		return nil, fmt.Errorf("could not list zulip streams: %v", streamsResp.Msg)
+	}
+
+	var streams []string
+	for _, stream := range streamsResp.Streams {
+		streams = append(streams, stream.Name)
+	}
+	zsl.streams = streams
+	zsl.fetched = time.Now()
+	return streams, nil
+}
+
 func (zur *zulipUserRequest) validateJSON(r *http.Request) error {
 	var userReq incomingJSON
 	// Look at the incoming webhook and slurp up the JSON
@@ -160,6 +223,14 @@ func (mun *mockUserNotification) sendUserMessage(ctx context.Context, botPasswor
 	return nil
 }
 
+// implements streamLister
+type mockStreamLister struct {
+}
+
+func (msl *mockStreamLister) listStreams(ctx context.Context, botPassword string) ([]string, error) {
+	return nil, nil
+}
+
 func (mur *mockUserRequest) validateJSON(r *http.Request) error {
 	return nil
 }
@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"strings"
 	"time"
 
 	"cloud.google.com/go/firestore"
@@ -16,7 +15,6 @@ import (
 // 	"id":                 "string",
 // 	"name":               "string",
 // 	"email":              "string",
-// 	"isSkippingTomorrow": false,
 // 	"schedule": map[string]interface{}{
 // 		"monday":    false,
 // 		"tuesday":   false,
@@ -29,39 +27,214 @@ import (
 //  "streams": map[string]int{
 // 		"any":       0,
 // 	},
-
+//  "streamOrder": []string{"any"},
+//  "dayStreams": map[string]map[string]int{
+// 		"monday": {"rust": 1},
+// 	},
+//  "dayStreamOrder": map[string][]string{
+// 		"monday": {"rust"},
+// 	},
+//  "blocked": map[string]string{
+// 		"id": "name",
+// 	},
+//  "preferred": map[string]string{
+// 		"id": "name",
+// 	},
+//  "level":      "beginner",
+//  "role":       "mentee",
+//  "levelMatch": "similar",
+//  "languages":  []string{"go", "rust"},
+//  "timezone":   "America/New_York",
+//  "hours":      "10:00-16:00",
+//  "timesLeftOut": 0,
+//  "lastLeftOut":  "2006-01-02",
+//  "skipping":     []string{"2006-01-02"},
+//  "paused":       false,
+//  "pausedUntil":  "2006-01-02",
+//  "suspended":    false,
+//  "noShowReports": map[string]string{
+// 		"id": "2006-01-02",
+// 	},
 
 type Recurser struct {
-	id                 string
-	name               string
-	email              string
-	isSkippingTomorrow bool
-	schedule           map[string]interface{}
-	streams            map[string]int
-	isSubscribed       bool
+	id           string
+	name         string
+	email        string
+	schedule     map[string]interface{}
+	streams      map[string]int
+	isSubscribed bool
+	// the dates they don't want to be matched on, as YYYY-MM-DD in their own time zone
+	skipping []string
+	// paused people keep their settings but aren't matched until they resume,
+	// or until pausedUntil (YYYY-MM-DD in their own time zone) if it's set
+	paused      bool
+	pausedUntil string
+	// suspended people were reported with `noshow` by noShowLimit different
+	// partners (their IDs, and the date of the match). They aren't matched
+	// until they resume
+	suspended     bool
+	noShowReports map[string]string
+	// the streams in the order they were given, most important first
+	streamOrder []string
+	// streams (and their order) for particular days of the week, which
+	// replace their usual ones on those days
+	dayStreams     map[string]map[string]int
+	dayStreamOrder map[string][]string
+	// how many times they've been the odd one out, and the last date it happened
+	timesLeftOut int
+	lastLeftOut  string
+	// the IDs (and names) of people they never want to be matched with.
+	// this is private: it's never shown to anyone but them
+	blocked map[string]string
+	// the IDs (and names) of people they'd like to be matched with.
+	// it only counts when both people prefer each other
+	preferred map[string]string
+	// one of experienceLevels, or "" if they haven't said
+	level string
+	// "mentor", "mentee" or "peer"
+	role string
+	// whether they'd like partners at a "similar" level, "across" levels, or "any"
+	levelMatch string
+	// the programming languages they'd like to pair in
+	languages []string
+	// an IANA time zone name like America/New_York, or "" for defaultTimezone
+	timezone string
+	// when they're free each day in their own time zone, like 10:00-16:00,
+	// or "" if they're free all day
+	hours string
 }
 
 func (r *Recurser) ConvertToMap() map[string]interface{} {
 	// NOTE: not sure if it is possible for Recurser to not have attribute streams (I don't know how they are stored in db)
 	return map[string]interface{}{
-		"id":                 r.id,
-		"name":               r.name,
-		"email":              r.email,
-		"isSkippingTomorrow": r.isSkippingTomorrow,
-		"schedule":           r.schedule,
-		"streams":            r.streams,
+		"id":             r.id,
+		"name":           r.name,
+		"email":          r.email,
+		"schedule":       r.schedule,
+		"streams":        r.streams,
+		"skipping":       r.skipping,
+		"paused":         r.paused,
+		"pausedUntil":    r.pausedUntil,
+		"suspended":      r.suspended,
+		"noShowReports":  r.noShowReports,
+		"streamOrder":    r.streamOrder,
+		"dayStreams":     r.dayStreams,
+		"dayStreamOrder": r.dayStreamOrder,
+		"timesLeftOut":   r.timesLeftOut,
+		"lastLeftOut":    r.lastLeftOut,
+		"blocked":        r.blocked,
+		"preferred":      r.preferred,
+		"level":          r.level,
+		"role":           r.role,
+		"levelMatch":     r.levelMatch,
+		"languages":      r.languages,
+		"timezone":       r.timezone,
+		"hours":          r.hours,
 	}
 }
 
 func MapToStruct(m map[string]interface{}) Recurser {
 	// isSubscribed is missing here because it's not in the map
-	return Recurser{id: m["id"].(string),
-		name:               m["name"].(string),
-		email:              m["email"].(string),
-		isSkippingTomorrow: m["isSkippingTomorrow"].(bool),
-		schedule:           m["schedule"].(map[string]interface{}),
-		streams:            m["stream"].(map[string]int),
+	r := Recurser{id: m["id"].(string),
+		name:     m["name"].(string),
+		email:    m["email"].(string),
+		schedule: m["schedule"].(map[string]interface{}),
+		streams:  mapToStreams(m["streams"]),
+	}
+	// these fields were added later, so older documents might not have them
+	r.skipping = mapToStrings(m["skipping"])
+	r.paused, _ = m["paused"].(bool)
+	r.pausedUntil, _ = m["pausedUntil"].(string)
+	r.suspended, _ = m["suspended"].(bool)
+	r.noShowReports = mapToStringMap(m["noShowReports"])
+	r.streamOrder = mapToStrings(m["streamOrder"])
+	r.dayStreams = make(map[string]map[string]int)
+	if days, ok := m["dayStreams"].(map[string]interface{}); ok {
+		for day, streams := range days {
+			r.dayStreams[day] = mapToStreams(streams)
+		}
+	}
+	r.dayStreamOrder = make(map[string][]string)
+	if days, ok := m["dayStreamOrder"].(map[string]interface{}); ok {
+		for day, order := range days {
+			r.dayStreamOrder[day] = mapToStrings(order)
+		}
+	}
+	r.timesLeftOut = mapToInt(m["timesLeftOut"])
+	r.lastLeftOut, _ = m["lastLeftOut"].(string)
+	r.blocked = mapToStringMap(m["blocked"])
+	r.preferred = mapToStringMap(m["preferred"])
+	r.level, _ = m["level"].(string)
+	r.role, _ = m["role"].(string)
+	r.levelMatch, _ = m["levelMatch"].(string)
+	r.languages = mapToStrings(m["languages"])
+	r.timezone, _ = m["timezone"].(string)
+	r.hours, _ = m["hours"].(string)
+	return r
+}
+
+// firestore gives arrays back to us as []interface{}
+func mapToStrings(v interface{}) []string {
+	var strs []string
+	list, _ := v.([]interface{})
+	for _, s := range list {
+		if str, ok := s.(string); ok {
+			strs = append(strs, str)
+		}
+	}
+	return strs
+}
+
+// firestore gives maps back to us as map[string]interface{}
+func mapToStringMap(v interface{}) map[string]string {
+	strs := make(map[string]string)
+	m, _ := v.(map[string]interface{})
+	for k, s := range m {
+		if str, ok := s.(string); ok {
+			strs[k] = str
+		}
+	}
+	return strs
+}
+
+// firestore gives numbers back to us as int64s
+func mapToInt(v interface{}) int {
+	switch n := v.(type) {
+	case int64:
+		return int(n)
+	case int:
+		return n
+	case float64:
+		return int(n)
+	}
+	return 0
+}
+
+// firestore gives numbers back to us as int64s inside a map[string]interface{},
+// so the streams map has to be rebuilt by hand
+func mapToStreams(v interface{}) map[string]int {
+	streams := make(map[string]int)
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		// recursers who subscribed before streams existed
+		streams["any"] = 1
+		return streams
+	}
+	for stream, count := range m {
+		streams[stream] = mapToInt(count)
+	}
+	return streams
+}
+
+// mergeTopLevel makes a Set overwrite each of the given top-level fields as a
+// whole, instead of merging nested maps key by key (firestore.MergeAll would
+// keep a stream around forever after the user removed it)
+func mergeTopLevel(m map[string]interface{}) firestore.SetOption {
+	var fields []firestore.FieldPath
+	for k := range m {
+		fields = append(fields, firestore.FieldPath{k})
 	}
+	return firestore.Merge(fields...)
 }
 
 // DB Lookups of Pairing Bot subscribers (= "Recursers")
@@ -71,9 +244,14 @@ type RecurserDB interface {
 	GetAllUsers(ctx context.Context) ([]Recurser, error)
 	Set(ctx context.Context, userID string, recurser Recurser) error
 	Delete(ctx context.Context, userID string) error
-	ListPairingTomorrow(ctx context.Context) ([]Recurser, error)
-	ListSkippingTomorrow(ctx context.Context) ([]Recurser, error)
-	UnsetSkippingTomorrow(ctx context.Context, recurser Recurser) error
+	// ListPairingTomorrow gets everyone who should be matched by a run at the given
+	// time, going by the schedule, skips and pauses for their own local day (see localPairingDay).
+	// Their streams are the ones for that day, so they shouldn't be saved back with Set
+	ListPairingTomorrow(ctx context.Context, day time.Time) ([]Recurser, error)
+	ListPaused(ctx context.Context) ([]Recurser, error)
+	// ConvertSkippingTomorrow turns the old isSkippingTomorrow field into a skip
+	// for the run at the given time, and deletes it
+	ConvertSkippingTomorrow(ctx context.Context, day time.Time) error
 }
 
 // implements RecurserDB
@@ -106,10 +284,9 @@ func (f *FirestoreRecurserDB) GetByUserID(ctx context.Context, userID, userEmail
 	} else {
 		// User is not subscribed, so provide a default recurser struct instead.
 		r = Recurser{
-			id:                 userID,
-			name:               userName,
-			email:              userEmail,
-			isSkippingTomorrow: false,
+			id:    userID,
+			name:  userName,
+			email: userEmail,
 			schedule: map[string]interface{}{
 				"monday":    true,
 				"tuesday":   true,
@@ -119,9 +296,10 @@ func (f *FirestoreRecurserDB) GetByUserID(ctx context.Context, userID, userEmail
 				"saturday":  false,
 				"sunday":    false,
 			},
-            streams: map[string]int{
+			streams: map[string]int{
 				"any": 1,
 			},
+			streamOrder: []string{"any"},
 		}
 	}
 	// now put the data from the recurser map into a Recurser struct
@@ -153,7 +331,7 @@ func (f *FirestoreRecurserDB) GetAllUsers(ctx context.Context) ([]Recurser, erro
 func (f *FirestoreRecurserDB) Set(ctx context.Context, userID string, recurser Recurser) error {
 
 	r := recurser.ConvertToMap()
-	_, err := f.client.Collection("recursers").Doc(userID).Set(ctx, r, firestore.MergeAll)
+	_, err := f.client.Collection("recursers").Doc(userID).Set(ctx, r, mergeTopLevel(r))
 	return err
 
 }
@@ -163,13 +341,7 @@ func (f *FirestoreRecurserDB) Delete(ctx context.Context, userID string) error {
 	return err
 }
 
-func (f *FirestoreRecurserDB) ListPairingTomorrow(ctx context.Context) ([]Recurser, error) {
-	// this gets the time from system time, which is UTC
-	// on app engine (and most other places). This works
-	// fine for us in NYC, but might not if pairing bot
-	// were ever running in another time zone
-	today := strings.ToLower(time.Now().Weekday().String())
-
+func (f *FirestoreRecurserDB) ListPairingTomorrow(ctx context.Context, day time.Time) ([]Recurser, error) {
 	var recursersList []Recurser
 	var r Recurser
 
@@ -177,7 +349,9 @@ func (f *FirestoreRecurserDB) ListPairingTomorrow(ctx context.Context) ([]Recurs
 	// this query returns an iterator, and then we have to use firestore
 	// magic to iterate across the results of the query and store them
 	// into our 'recursersList' variable which is a slice of map[string]interface{}
-	iter := f.client.Collection("recursers").Where("isSkippingTomorrow", "==", false).Where("schedule."+today, "==", true).Documents(ctx)
+	// which day to look at depends on each recurser's time zone, so
+	// firestore can't filter by schedule, skips or pauses for us
+	iter := f.client.Collection("recursers").Documents(ctx)
 	for {
 		doc, err := iter.Next()
 		if err == iterator.Done {
@@ -189,18 +363,19 @@ func (f *FirestoreRecurserDB) ListPairingTomorrow(ctx context.Context) ([]Recurs
 
 		r = MapToStruct(doc.Data())
 
-		recursersList = append(recursersList, r)
+		if r.isScheduledOn(day) && !r.isSkipping(day) && !r.isPaused(day) {
+			recursersList = append(recursersList, r.onDay(day))
+		}
 	}
 
 	return recursersList, nil
 }
 
-func (f *FirestoreRecurserDB) ListSkippingTomorrow(ctx context.Context) ([]Recurser, error) {
-
-	var skippersList []Recurser
+func (f *FirestoreRecurserDB) ListPaused(ctx context.Context) ([]Recurser, error) {
+	var pausedList []Recurser
 	var r Recurser
 
-	iter := f.client.Collection("recursers").Where("isSkippingTomorrow", "==", true).Documents(ctx)
+	iter := f.client.Collection("recursers").Where("paused", "==", true).Documents(ctx)
 	for {
 		doc, err := iter.Next()
 		if err == iterator.Done {
@@ -212,18 +387,33 @@ func (f *FirestoreRecurserDB) ListSkippingTomorrow(ctx context.Context) ([]Recur
 
 		r = MapToStruct(doc.Data())
 
-		skippersList = append(skippersList, r)
+		pausedList = append(pausedList, r)
 	}
-	return skippersList, nil
+	return pausedList, nil
 }
 
-func (f *FirestoreRecurserDB) UnsetSkippingTomorrow(ctx context.Context, recurser Recurser) error {
-
-	r := recurser.ConvertToMap()
-	r["isSkippingTomorrow"] = false
+func (f *FirestoreRecurserDB) ConvertSkippingTomorrow(ctx context.Context, day time.Time) error {
+	// isSkippingTomorrow was always about the next run, which is this one
+	iter := f.client.Collection("recursers").Where("isSkippingTomorrow", "in", []interface{}{true, false}).Documents(ctx)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return err
+		}
 
-	_, err := f.client.Collection("recursers").Doc(r["id"].(string)).Set(ctx, r, firestore.MergeAll)
-	return err
+		updates := []firestore.Update{{Path: "isSkippingTomorrow", Value: firestore.Delete}}
+		if doc.Data()["isSkippingTomorrow"] == true {
+			r := MapToStruct(doc.Data())
+			updates = append(updates, firestore.Update{Path: "skipping", Value: firestore.ArrayUnion(r.skipDay(day))})
+		}
+		if _, err := doc.Ref.Update(ctx, updates); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // implements RecurserDB
@@ -245,18 +435,369 @@ func (m *MockRecurserDB) Delete(ctx context.Context, userID string) error {
 	return nil
 }
 
-func (m *MockRecurserDB) ListPairingTomorrow(ctx context.Context) ([]Recurser, error) {
+func (m *MockRecurserDB) ListPairingTomorrow(ctx context.Context, day time.Time) ([]Recurser, error) {
 	return nil, nil
 }
 
-func (m *MockRecurserDB) ListSkippingTomorrow(ctx context.Context) ([]Recurser, error) {
+func (m *MockRecurserDB) ListPaused(ctx context.Context) ([]Recurser, error) {
 	return nil, nil
 }
 
-func (m *MockRecurserDB) UnsetSkippingTomorrow(ctx context.Context, userID string) error {
+func (m *MockRecurserDB) ConvertSkippingTomorrow(ctx context.Context, day time.Time) error {
 	return nil
 }
 
+// DB Lookups of past matches
+
+// a matchRecord is one group that was matched on a given day
+type matchRecord struct {
+	// the document's ID in the database, which isn't stored in the document itself
+	id      string
+	date    string
+	stream  string
+	members []string
+	// names are kept so a record still makes sense after someone unsubscribes
+	names map[string]string
+	// what each member said when asked whether they paired: "yes", "no", or a rating from "1" to "5"
+	feedback map[string]string
+	// members who cancelled with `decline`
+	declined []string
+}
+
+func (m *matchRecord) ConvertToMap() map[string]interface{} {
+	feedback := m.feedback
+	if feedback == nil {
+		feedback = make(map[string]string)
+	}
+	declined := m.declined
+	if declined == nil {
+		declined = []string{}
+	}
+	return map[string]interface{}{
+		"date":     m.date,
+		"stream":   m.stream,
+		"members":  m.members,
+		"names":    m.names,
+		"feedback": feedback,
+		"declined": declined,
+	}
+}
+
+// active are the members who haven't declined. If there are fewer than
+// two, the match is off
+func (m *matchRecord) active() []string {
+	var active []string
+	for _, member := range m.members {
+		if !contains(m.declined, member) {
+			active = append(active, member)
+		}
+	}
+	return active
+}
+
+func MapToMatchRecord(m map[string]interface{}) matchRecord {
+	record := matchRecord{
+		date:   m["date"].(string),
+		stream: m["stream"].(string),
+		names:  make(map[string]string),
+	}
+	if members, ok := m["members"].([]interface{}); ok {
+		for _, member := range members {
+			record.members = append(record.members, member.(string))
+		}
+	}
+	if names, ok := m["names"].(map[string]interface{}); ok {
+		for id, name := range names {
+			record.names[id] = name.(string)
+		}
+	}
+	record.feedback = mapToStringMap(m["feedback"])
+	record.declined = mapToStrings(m["declined"])
+	return record
+}
+
+// a matchRun is one day's run of "match": the seed it used and everyone who
+// was eligible, which is enough to replay it later, and who was left out
+type matchRun struct {
+	date string
+	// exactly when it ran, since which local day it was for depends on it
+	ranAt     time.Time
+	seed      int64
+	recursers []Recurser
+	// the past matches it went by, as they were then, so a replay doesn't
+	// depend on what PB_REPEAT_WINDOW_DAYS is now or on later changes to them
+	history []matchRecord
+	leftOut []string
+}
+
+func (m *matchRun) ConvertToMap() map[string]interface{} {
+	var recursers []map[string]interface{}
+	for _, r := range m.recursers {
+		recursers = append(recursers, r.ConvertToMap())
+	}
+	history := []map[string]interface{}{}
+	for _, record := range m.history {
+		history = append(history, record.ConvertToMap())
+	}
+	return map[string]interface{}{
+		"date":      m.date,
+		"ranAt":     m.ranAt,
+		"seed":      m.seed,
+		"recursers": recursers,
+		"history":   history,
+		"leftOut":   m.leftOut,
+	}
+}
+
+func MapToMatchRun(m map[string]interface{}) matchRun {
+	run := matchRun{
+		date: m["date"].(string),
+		seed: m["seed"].(int64),
+	}
+	if recursers, ok := m["recursers"].([]interface{}); ok {
+		for _, r := range recursers {
+			run.recursers = append(run.recursers, MapToStruct(r.(map[string]interface{})))
+		}
+	}
+	if history, ok := m["history"].([]interface{}); ok {
+		for _, record := range history {
+			run.history = append(run.history, MapToMatchRecord(record.(map[string]interface{})))
+		}
+	}
+	run.leftOut = mapToStrings(m["leftOut"])
+	// runs saved before ranAt was are all from the usual time
+	if ranAt, ok := m["ranAt"].(time.Time); ok {
+		run.ranAt = ranAt
+	} else if day, err := time.Parse(dateLayout, run.date); err == nil {
+		run.ranAt = day.Add(matchHourUTC * time.Hour)
+	}
+	return run
+}
+
+// a pairNowRequest is someone waiting in the `pair now` queue. There's one
+// per person, under their ID, and it's only good for pairNowWindow
+type pairNowRequest struct {
+	id     string
+	name   string
+	email  string
+	stream string
+	// the IDs of everyone they've blocked
+	blocked []string
+	since   time.Time
+}
+
+func (p *pairNowRequest) ConvertToMap() map[string]interface{} {
+	blocked := p.blocked
+	if blocked == nil {
+		blocked = []string{}
+	}
+	return map[string]interface{}{
+		"id":      p.id,
+		"name":    p.name,
+		"email":   p.email,
+		"stream":  p.stream,
+		"blocked": blocked,
+		"since":   p.since,
+	}
+}
+
+func MapToPairNowRequest(m map[string]interface{}) pairNowRequest {
+	p := pairNowRequest{
+		id:      m["id"].(string),
+		name:    m["name"].(string),
+		email:   m["email"].(string),
+		stream:  m["stream"].(string),
+		blocked: mapToStrings(m["blocked"]),
+	}
+	p.since, _ = m["since"].(time.Time)
+	return p
+}
+
+type MatchHistoryDB interface {
+	Add(ctx context.Context, record matchRecord) error
+	// ListSince gets every match made on or after the given date (YYYY-MM-DD)
+	ListSince(ctx context.Context, date string) ([]matchRecord, error)
+	// ListForUser gets every match the user was in on or after the given date
+	ListForUser(ctx context.Context, userID, date string) ([]matchRecord, error)
+	// SetFeedback records what one member of a match said about it
+	SetFeedback(ctx context.Context, recordID, userID, feedback string) error
+	// Decline records that one member of a match can't make it
+	Decline(ctx context.Context, recordID, userID string) error
+	SetRun(ctx context.Context, run matchRun) error
+	GetRun(ctx context.Context, date string) (matchRun, error)
+	// DeleteRunsBefore deletes the runs from before the given date
+	DeleteRunsBefore(ctx context.Context, date string) error
+	// PairNow takes the longest-waiting request since cutoff that fits with
+	// request out of the `pair now` queue, or if there isn't one, puts request
+	// in the queue instead. Either way it's done all at once, so two people
+	// asking at the same time can't both end up waiting
+	PairNow(ctx context.Context, request pairNowRequest, cutoff time.Time) (pairNowRequest, bool, error)
+}
+
+// implements MatchHistoryDB
+type FirestoreMatchHistoryDB struct {
+	client *firestore.Client
+}
+
+func (f *FirestoreMatchHistoryDB) Add(ctx context.Context, record matchRecord) error {
+	_, _, err := f.client.Collection("matches").Add(ctx, record.ConvertToMap())
+	return err
+}
+
+func (f *FirestoreMatchHistoryDB) ListSince(ctx context.Context, date string) ([]matchRecord, error) {
+	var records []matchRecord
+
+	iter := f.client.Collection("matches").Where("date", ">=", date).Documents(ctx)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		record := MapToMatchRecord(doc.Data())
+		record.id = doc.Ref.ID
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (f *FirestoreMatchHistoryDB) ListForUser(ctx context.Context, userID, date string) ([]matchRecord, error) {
+	var records []matchRecord
+
+	// filtering by date here too would need a composite index,
+	// and one person's matches are few enough to filter ourselves
+	iter := f.client.Collection("matches").Where("members", "array-contains", userID).Documents(ctx)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		record := MapToMatchRecord(doc.Data())
+		record.id = doc.Ref.ID
+		if record.date >= date {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func (f *FirestoreMatchHistoryDB) SetFeedback(ctx context.Context, recordID, userID, feedback string) error {
+	// only this member's answer is touched, in case the others answer at the same time
+	_, err := f.client.Collection("matches").Doc(recordID).Update(ctx, []firestore.Update{
+		{FieldPath: firestore.FieldPath{"feedback", userID}, Value: feedback},
+	})
+	return err
+}
+
+func (f *FirestoreMatchHistoryDB) Decline(ctx context.Context, recordID, userID string) error {
+	_, err := f.client.Collection("matches").Doc(recordID).Update(ctx, []firestore.Update{
+		{Path: "declined", Value: firestore.ArrayUnion(userID)},
+	})
+	return err
+}
+
+func (f *FirestoreMatchHistoryDB) SetRun(ctx context.Context, run matchRun) error {
+	_, err := f.client.Collection("runs").Doc(run.date).Set(ctx, run.ConvertToMap())
+	return err
+}
+
+func (f *FirestoreMatchHistoryDB) GetRun(ctx context.Context, date string) (matchRun, error) {
+	doc, err := f.client.Collection("runs").Doc(date).Get(ctx)
+	if err != nil {
+		return matchRun{}, err
+	}
+	return MapToMatchRun(doc.Data()), nil
+}
+
+func (f *FirestoreMatchHistoryDB) DeleteRunsBefore(ctx context.Context, date string) error {
+	iter := f.client.Collection("runs").Where("date", "<", date).Documents(ctx)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := doc.Ref.Delete(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FirestoreMatchHistoryDB) PairNow(ctx context.Context, request pairNowRequest, cutoff time.Time) (pairNowRequest, bool, error) {
+	queue := f.client.Collection("pairnow")
+	var partner pairNowRequest
+	var found bool
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		// transactions can be retried, so start over every time
+		partner, found = pairNowRequest{}, false
+		docs, err := tx.Documents(queue.Where("since", ">", cutoff).OrderBy("since", firestore.Asc)).GetAll()
+		if err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			waiting := MapToPairNowRequest(doc.Data())
+			if waiting.id == request.id || !request.fits(waiting) {
+				continue
+			}
+			partner, found = waiting, true
+			if err := tx.Delete(doc.Ref); err != nil {
+				return err
+			}
+			// in case they were already waiting themselves
+			return tx.Delete(queue.Doc(request.id))
+		}
+		return tx.Set(queue.Doc(request.id), request.ConvertToMap())
+	})
+	return partner, found, err
+}
+
+// implements MatchHistoryDB
+type MockMatchHistoryDB struct{}
+
+func (m *MockMatchHistoryDB) Add(ctx context.Context, record matchRecord) error {
+	return nil
+}
+
+func (m *MockMatchHistoryDB) ListSince(ctx context.Context, date string) ([]matchRecord, error) {
+	return nil, nil
+}
+
+func (m *MockMatchHistoryDB) ListForUser(ctx context.Context, userID, date string) ([]matchRecord, error) {
+	return nil, nil
+}
+
+func (m *MockMatchHistoryDB) SetFeedback(ctx context.Context, recordID, userID, feedback string) error {
+	return nil
+}
+
+func (m *MockMatchHistoryDB) Decline(ctx context.Context, recordID, userID string) error {
+	return nil
+}
+
+func (m *MockMatchHistoryDB) SetRun(ctx context.Context, run matchRun) error {
+	return nil
+}
+
+func (m *MockMatchHistoryDB) GetRun(ctx context.Context, date string) (matchRun, error) {
+	return matchRun{}, nil
+}
+
+func (m *MockMatchHistoryDB) DeleteRunsBefore(ctx context.Context, date string) error {
+	return nil
+}
+
+func (m *MockMatchHistoryDB) PairNow(ctx context.Context, request pairNowRequest, cutoff time.Time) (pairNowRequest, bool, error) {
+	return pairNowRequest{}, false, nil
+}
+
 // DB Lookups of tokens
 
 type APIAuthDB interface {
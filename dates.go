@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// the longest stretch someone can skip in one go
+const maxSkipDays = 62
+
+// parseDates works out which days someone means when they say things like
+// `skip tomorrow`, `skip friday`, `skip next week`, `skip 2026-10-21` or
+// `skip 10/20-10/24`. today is the date it is for them right now.
+// Dates without a year are in the next year if they'd otherwise be in the past.
+// It doesn't check whether the dates it returns are in the past
+func parseDates(what string, today time.Time) ([]time.Time, error) {
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	what = strings.TrimSpace(strings.ToLower(what))
+
+	switch {
+	case what == "tomorrow":
+		return []time.Time{today.AddDate(0, 0, 1)}, nil
+
+	case what == "next week":
+		// weeks start on monday
+		daysUntilMonday := (8 - int(today.Weekday())) % 7
+		if daysUntilMonday == 0 {
+			daysUntilMonday = 7
+		}
+		monday := today.AddDate(0, 0, daysUntilMonday)
+		return dateRange(monday, monday.AddDate(0, 0, 6))
+
+	case weekday(what) != -1:
+		// the next one, never today
+		days := (int(weekday(what)) - int(today.Weekday()) + 7) % 7
+		if days == 0 {
+			days = 7
+		}
+		return []time.Time{today.AddDate(0, 0, days)}, nil
+
+	case strings.Count(what, "-") == 2 && !strings.Contains(what, "/"):
+		date, err := time.Parse(dateLayout, what)
+		if err != nil {
+			return nil, fmt.Errorf("%v isn't a date like 2006-01-02", what)
+		}
+		return []time.Time{date}, nil
+
+	case strings.Contains(what, "/"):
+		ends := strings.Split(what, "-")
+		if len(ends) > 2 {
+			return nil, fmt.Errorf("%v isn't a date range like 10/20-10/24", what)
+		}
+		first, err := parseMonthDay(ends[0], today)
+		if err != nil {
+			return nil, err
+		}
+		if len(ends) == 1 {
+			return []time.Time{first}, nil
+		}
+		last, err := parseMonthDay(ends[1], first)
+		if err != nil {
+			return nil, err
+		}
+		return dateRange(first, last)
+	}
+	return nil, fmt.Errorf("I don't know what day %q is", what)
+}
+
+// parseMonthDay parses a date like 10/20, picking the first one on or after from
+func parseMonthDay(s string, from time.Time) (time.Time, error) {
+	date, err := time.Parse("1/2", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%v isn't a date like 10/20", s)
+	}
+	date = time.Date(from.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	if date.Before(from) {
+		date = date.AddDate(1, 0, 0)
+	}
+	return date, nil
+}
+
+// dateRange is every day from first to last, inclusive
+func dateRange(first, last time.Time) ([]time.Time, error) {
+	if last.Before(first) {
+		return nil, errors.New("that range ends before it starts")
+	}
+	var dates []time.Time
+	for date := first; !date.After(last); date = date.AddDate(0, 0, 1) {
+		if len(dates) == maxSkipDays {
+			return nil, fmt.Errorf("that's more than %v days. You could `unsubscribe` instead!", maxSkipDays)
+		}
+		dates = append(dates, date)
+	}
+	return dates, nil
+}
+
+// weekday is -1 if day isn't the name of a weekday
+func weekday(day string) time.Weekday {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.ToLower(d.String()) == day {
+			return d
+		}
+	}
+	return -1
+}
+
+// skipDay is the date someone's skips are compared against on a run at the
+// given time: their own local pairing day, as YYYY-MM-DD
+func (r *Recurser) skipDay(now time.Time) string {
+	return r.localPairingDay(now).Format(dateLayout)
+}
+
+// isSkipping says whether a matching run at the given time should leave the recurser out
+func (r *Recurser) isSkipping(now time.Time) bool {
+	return contains(r.skipping, r.skipDay(now))
+}
+
+// isPaused says whether the recurser's pause covers a matching run at the
+// given time. A pause with an end date is over on that date. Being suspended
+// for not showing up is a pause too, until they resume
+func (r *Recurser) isPaused(now time.Time) bool {
+	return r.suspended || (r.paused && (r.pausedUntil == "" || r.skipDay(now) < r.pausedUntil))
+}
+
+// upcomingSkips are the dates they're skipping from today on, in their own
+// time zone. Skips before that don't matter anymore, so they're dropped
+// whenever the recurser is saved
+func (r *Recurser) upcomingSkips(now time.Time) []string {
+	today := now.In(r.location()).Format(dateLayout)
+	var upcoming []string
+	for _, date := range r.skipping {
+		// YYYY-MM-DD sorts the same as the dates themselves
+		if date >= today && !contains(upcoming, date) {
+			upcoming = append(upcoming, date)
+		}
+	}
+	sort.Strings(upcoming)
+	return upcoming
+}
+
+// dateRuns makes a sorted list of YYYY-MM-DD dates readable, collapsing
+// consecutive days: "Friday, October 23" or "Monday, October 26 to Friday, October 30"
+func dateRuns(dates []string) []string {
+	var runs []string
+	var first, last time.Time
+	for i, d := range dates {
+		date, err := time.Parse(dateLayout, d)
+		if err != nil {
+			continue
+		}
+		if i > 0 && date.Equal(last.AddDate(0, 0, 1)) {
+			last = date
+		} else {
+			if !first.IsZero() {
+				runs = append(runs, formatRun(first, last))
+			}
+			first, last = date, date
+		}
+	}
+	if !first.IsZero() {
+		runs = append(runs, formatRun(first, last))
+	}
+	return runs
+}
+
+func formatRun(first, last time.Time) string {
+	if first.Equal(last) {
+		return first.Format("Monday, January 2")
+	}
+	return first.Format("Monday, January 2") + " to " + last.Format("Monday, January 2")
+}
+
+// formatDates is dateRuns as one sentence
+func formatDates(dates []string) string {
+	return joinAnd(dateRuns(dates))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDates(t *testing.T) {
+	// a saturday
+	today := time.Date(2026, time.October, 17, 15, 0, 0, 0, time.UTC)
+
+	var tableParseDates = []struct {
+		input  string
+		wanted string
+		ok     bool
+	}{
+		{"tomorrow", "2026-10-18", true},
+		{"friday", "2026-10-23", true},
+		{"saturday", "2026-10-24", true},
+		{"sunday", "2026-10-18", true},
+		{"next week", "2026-10-19 2026-10-20 2026-10-21 2026-10-22 2026-10-23 2026-10-24 2026-10-25", true},
+		{"2026-10-21", "2026-10-21", true},
+		{"10/21", "2026-10-21", true},
+		{"10/20-10/22", "2026-10-20 2026-10-21 2026-10-22", true},
+		{"12/31-1/1", "2026-12-31 2027-01-01", true},
+		{"1/5", "2027-01-05", true},
+		{"10/24-10/20", "", false},
+		{"10/1-12/31", "", false},
+		{"2026-02-30", "", false},
+		{"13/1", "", false},
+		{"someday", "", false},
+	}
+	for _, tt := range tableParseDates {
+		dates, err := parseDates(tt.input, today)
+		var got []string
+		for _, date := range dates {
+			got = append(got, date.Format(dateLayout))
+		}
+		if strings.Join(got, " ") != tt.wanted || (err == nil) != tt.ok {
+			t.Errorf("parseDates(%q) got %v, %v, wanted %v\n", tt.input, got, err, tt.wanted)
+		}
+	}
+}
+
+func TestSkipping(t *testing.T) {
+	r := Recurser{timezone: "Asia/Tokyo", skipping: []string{"2026-10-15", "2026-10-10", "2026-10-15"}}
+
+	// at 04:00 UTC on the 14th it's already the afternoon of the 14th in Tokyo,
+	// so that run is for the 15th there
+	run := time.Date(2026, time.October, 14, 4, 0, 0, 0, time.UTC)
+	if !r.isSkipping(run) {
+		t.Errorf("expected them to skip the run for %v\n", r.skipDay(run))
+	}
+	if r.isSkipping(run.AddDate(0, 0, 1)) {
+		t.Errorf("didn't expect them to skip the run for %v\n", r.skipDay(run.AddDate(0, 0, 1)))
+	}
+
+	if got := r.upcomingSkips(run); len(got) != 1 || got[0] != "2026-10-15" {
+		t.Errorf("got upcoming skips %v, wanted [2026-10-15]\n", got)
+	}
+}
+
+func TestFormatDates(t *testing.T) {
+	got := formatDates([]string{"2026-10-19", "2026-10-20", "2026-10-21", "2026-10-23", "2026-10-26"})
+	wanted := "Monday, October 19 to Wednesday, October 21, Friday, October 23 and Monday, October 26"
+	if got != wanted {
+		t.Errorf("got %q, wanted %q\n", got, wanted)
+	}
+}
+
+func TestIsPaused(t *testing.T) {
+	run := time.Date(2026, time.October, 14, 4, 0, 0, 0, time.UTC)
+
+	var tableIsPaused = []struct {
+		recurser Recurser
+		wanted   bool
+	}{
+		{Recurser{}, false},
+		{Recurser{paused: true}, true},
+		{Recurser{paused: true, pausedUntil: "2026-10-15"}, true},
+		{Recurser{paused: true, pausedUntil: "2026-10-14"}, false},
+		// it's already the 15th in Tokyo
+		{Recurser{paused: true, pausedUntil: "2026-10-15", timezone: "Asia/Tokyo"}, false},
+		{Recurser{suspended: true}, true},
+		{Recurser{suspended: true, paused: true, pausedUntil: "2026-10-14"}, true},
+	}
+	for _, tt := range tableIsPaused {
+		if got := tt.recurser.isPaused(run); got != tt.wanted {
+			t.Errorf("paused %v until %q in %q: got %v, wanted %v\n", tt.recurser.paused, tt.recurser.pausedUntil, tt.recurser.timezone, got, tt.wanted)
+		}
+	}
+}
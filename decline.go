@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+const declinedMessage = "Hi! Sorry, %v can't pair today after all."
+const stillMatchedMessage = " You've still got each other, though!"
+const rematchedMessage = " I've found you someone else, so look out for a message from me :)"
+const notRematchedMessage = " I couldn't find anyone else who's free today, so you'll get priority next time <3"
+const rematchMessage = "Hi you two! Someone had to cancel, so you've been matched for pairing on %v instead :)\n\nHave fun!"
+
+// decline cancels someone's matches for their pairing day today. Whoever they
+// were matched with is told, and anyone it leaves on their own is matched again
+// with someone else from the same stream who's still free that day, if there's
+// anybody. It returns what to tell the person who declined
+func (pl *PairingLogic) decline(ctx context.Context, rec Recurser) (string, error) {
+	userID := rec.id
+	now := time.Now()
+	latest := rec.todaysRunDate(now)
+	records, err := pl.mdb.ListForUser(ctx, userID, latest)
+	if err != nil {
+		return readErrorMessage, err
+	}
+	declining := todaysMatches(records, rec, now)
+	if len(declining) == 0 {
+		return "You don't have a match today to cancel.", nil
+	}
+
+	// everything else that was matched that day, so it's clear who's still free
+	dayRecords, err := pl.mdb.ListSince(ctx, latest)
+	if err != nil {
+		return readErrorMessage, err
+	}
+	for i := 0; i < len(dayRecords); i++ {
+		if dayRecords[i].date != latest {
+			dayRecords = append(dayRecords[:i], dayRecords[i+1:]...)
+			i--
+		}
+	}
+
+	for _, record := range declining {
+		if err := pl.mdb.Decline(ctx, record.id, userID); err != nil {
+			return writeErrorMessage, err
+		}
+		for i := range dayRecords {
+			if dayRecords[i].id == record.id {
+				dayRecords[i].declined = append(dayRecords[i].declined, userID)
+			}
+		}
+	}
+
+	// without the run there's nobody to rematch with, but partners still need to know
+	run, err := pl.mdb.GetRun(ctx, latest)
+	if err != nil {
+		log.Printf("Could not get the run for %v from DB: %s\n", latest, err)
+	}
+	runTime := run.ranAt
+	if runTime.IsZero() {
+		runTime, _ = time.Parse(dateLayout, latest)
+		runTime = runTime.Add(matchHourUTC * time.Hour)
+	}
+
+	recursersList, err := pl.rdb.GetAllUsers(ctx)
+	if err != nil {
+		log.Printf("Could not get list of recursers from DB: %s\n", err)
+	}
+	emails := make(map[string]string)
+	for _, r := range recursersList {
+		emails[r.id] = r.email
+	}
+
+	botPassword, err := pl.adb.GetKey(ctx, "apiauth", "key")
+	if err != nil {
+		log.Println("Something weird happened trying to read the auth token from the database")
+	}
+
+	var partners []string
+	for _, record := range declining {
+		name := record.names[userID]
+		active := record.active()
+		for _, id := range active {
+			if id != userID {
+				partners = append(partners, record.names[id])
+			}
+		}
+		active = without(active, userID)
+
+		if len(active) > 1 {
+			message := fmt.Sprintf(declinedMessage, name) + stillMatchedMessage
+			var to []string
+			for _, id := range active {
+				to = append(to, emails[id])
+			}
+			if err := pl.un.sendUserMessage(ctx, botPassword, strings.Join(to, ", "), message); err != nil {
+				log.Printf("Error when trying to send declined message to %s: %s\n", to, err)
+			}
+			continue
+		}
+
+		partner, ok := findByID(run.recursers, active[0])
+		if !ok {
+			partner = Recurser{id: active[0], name: record.names[active[0]]}
+		}
+		if email, ok := emails[partner.id]; ok {
+			partner.email = email
+		}
+
+		var candidates []Recurser
+		if ok {
+			opts := matchOptions{matcherConfig: pl.config, date: runTime}
+			candidates = rematchCandidates(run, dayRecords, record.stream, partner, opts)
+		}
+		if len(candidates) == 0 {
+			pl.recordLeftOut(ctx, partner, latest)
+			if !contains(run.leftOut, partner.id) {
+				run.leftOut = append(run.leftOut, partner.id)
+			}
+			message := fmt.Sprintf(declinedMessage, name) + notRematchedMessage
+			if err := pl.un.sendUserMessage(ctx, botPassword, partner.email, message); err != nil {
+				log.Printf("Error when trying to send declined message to %s: %s\n", partner.email, err)
+			}
+			continue
+		}
+
+		other := candidates[0]
+		if email, ok := emails[other.id]; ok {
+			other.email = email
+		}
+		rematch := matchRecord{
+			date:    latest,
+			stream:  record.stream,
+			members: []string{partner.id, other.id},
+			names:   map[string]string{partner.id: partner.name, other.id: other.name},
+		}
+		if err := pl.mdb.Add(ctx, rematch); err != nil {
+			log.Printf("Could not record match in stream %v: %s\n", record.stream, err)
+		}
+		dayRecords = append(dayRecords, rematch)
+		run.leftOut = without(run.leftOut, other.id)
+
+		message := fmt.Sprintf(declinedMessage, name) + rematchedMessage
+		if err := pl.un.sendUserMessage(ctx, botPassword, partner.email, message); err != nil {
+			log.Printf("Error when trying to send declined message to %s: %s\n", partner.email, err)
+		}
+		pair := []Recurser{partner, other}
+		message = fmt.Sprintf(rematchMessage, formatList([]string{record.stream}))
+		for _, member := range pair {
+			if member.hours != "" {
+				message += fmt.Sprintf("\n\nYou're both free %v.", formatWindow(pair, runTime))
+				break
+			}
+		}
+		to := partner.email + ", " + other.email
+		if err := pl.un.sendUserMessage(ctx, botPassword, to, message); err != nil {
+			log.Printf("Error when trying to send rematch message to %s: %s\n", to, err)
+		}
+		log.Printf("%s were rematched in stream %v\n", partner.email+" and "+other.email, record.stream)
+	}
+
+	if run.date != "" {
+		if err := pl.mdb.SetRun(ctx, run); err != nil {
+			log.Printf("Could not record the run for %v: %s\n", run.date, err)
+		}
+	}
+
+	return fmt.Sprintf("OK, I've let %v know you can't make it. Thanks for telling me!", joinAnd(partners)), nil
+}
+
+// todaysMatches are the matches rec can still cancel at the given time: the
+// ones from the run for the day it is for them, that they haven't declined
+// already, and that someone else hasn't left them alone in
+func todaysMatches(records []matchRecord, rec Recurser, now time.Time) []matchRecord {
+	date := rec.todaysRunDate(now)
+	var matches []matchRecord
+	for _, record := range pairedMatches(records, rec.id) {
+		if record.date == date {
+			matches = append(matches, record)
+		}
+	}
+	return matches
+}
+
+// rematchCandidates are the people from a run who could be matched with
+// partner in stream, after partner's match there fell through: people who
+// wanted more pairings in the stream than they got, haven't declined anything
+// that day, aren't already matched with partner, and who partner could have
+// been matched with in the first place under opts. whoever was left out comes
+// first, then the usual left-out priority
+func rematchCandidates(run matchRun, records []matchRecord, stream string, partner Recurser, opts matchOptions) []Recurser {
+	matched := make(map[string]int)
+	declined := make(map[string]bool)
+	withPartner := make(map[string]bool)
+	for _, record := range records {
+		for _, id := range record.declined {
+			declined[id] = true
+		}
+		active := record.active()
+		if len(active) < 2 {
+			continue
+		}
+		for _, id := range active {
+			if record.stream == stream {
+				matched[id]++
+			}
+			if contains(active, partner.id) {
+				withPartner[id] = true
+			}
+		}
+	}
+
+	partnerDay := partner.localPairingDay(opts.date).Format(dateLayout)
+	var candidates []Recurser
+	for _, r := range run.recursers {
+		if r.id == partner.id || declined[r.id] || withPartner[r.id] {
+			continue
+		}
+		if r.streams[stream] <= matched[r.id] {
+			continue
+		}
+		if r.localPairingDay(opts.date).Format(dateLayout) != partnerDay || !opts.canGroup(r, partner) {
+			continue
+		}
+		candidates = append(candidates, r)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		one, two := candidates[i], candidates[j]
+		if oneOut, twoOut := contains(run.leftOut, one.id), contains(run.leftOut, two.id); oneOut != twoOut {
+			return oneOut
+		}
+		if leftOutBefore(one, two) != leftOutBefore(two, one) {
+			return leftOutBefore(one, two)
+		}
+		return one.id < two.id
+	})
+	return candidates
+}
+
+// findByID finds the recurser with the given zulip ID
+func findByID(recursers []Recurser, id string) (Recurser, bool) {
+	for _, r := range recursers {
+		if r.id == id {
+			return r, true
+		}
+	}
+	return Recurser{}, false
+}
+
+// without is list with every copy of item taken out
+func without(list []string, item string) []string {
+	var rest []string
+	for _, s := range list {
+		if s != item {
+			rest = append(rest, s)
+		}
+	}
+	return rest
+}
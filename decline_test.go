@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRematchCandidates(t *testing.T) {
+	partner := newTestRecurser("1", map[string]int{"rust": 1})
+	blocker := newTestRecurser("6", map[string]int{"rust": 1})
+	blocker.blocked = map[string]string{"1": "recurser 1"}
+	busy := newTestRecurser("7", map[string]int{"rust": 1})
+	busy.hours = "01:00-02:00"
+	partner.hours = "10:00-16:00"
+	// their hours overlap, but not for as long as the matcher wants
+	brief := newTestRecurser("10", map[string]int{"rust": 1})
+	brief.hours = "15:30-18:00"
+	lastWeek := newTestRecurser("8", map[string]int{"rust": 1})
+	lastWeek.lastLeftOut = "2026-10-10"
+
+	run := matchRun{
+		date: "2026-10-19",
+		recursers: []Recurser{
+			partner,
+			newTestRecurser("2", map[string]int{"rust": 1}),
+			newTestRecurser("3", map[string]int{"rust": 2}),
+			newTestRecurser("4", map[string]int{"rust": 1}),
+			newTestRecurser("5", map[string]int{"go": 1}),
+			blocker,
+			busy,
+			lastWeek,
+			newTestRecurser("9", map[string]int{"rust": 1}),
+			brief,
+		},
+		leftOut: []string{"9"},
+	}
+	records := []matchRecord{
+		// 2 declined on 1, which is why 1 needs someone else
+		{stream: "rust", members: []string{"1", "2"}, declined: []string{"2"}},
+		// 3 wants two pairings in rust and only has one. 4 is all booked
+		{stream: "rust", members: []string{"3", "4"}},
+	}
+
+	now := time.Date(2026, 10, 19, matchHourUTC, 0, 0, 0, time.UTC)
+	opts := matchOptions{matcherConfig: matcherConfig{minOverlap: time.Hour}, date: now}
+	candidates := rematchCandidates(run, records, "rust", partner, opts)
+	// 9 was left out today, 8 last week, and 3 just has room for another
+	wanted := []string{"9", "8", "3"}
+	if len(candidates) != len(wanted) {
+		t.Fatalf("got %v candidates, wanted %v\n", len(candidates), wanted)
+	}
+	for i, c := range candidates {
+		if c.id != wanted[i] {
+			t.Errorf("candidate %v is %v, wanted %v\n", i, c.id, wanted[i])
+		}
+	}
+}
+
+func TestTodaysMatches(t *testing.T) {
+	newYork := Recurser{id: "1", timezone: "America/New_York"}
+	tokyo := Recurser{id: "1", timezone: "Asia/Tokyo"}
+	berlin := Recurser{id: "1", timezone: "Europe/Berlin"}
+	yesterday := matchRecord{date: "2026-10-18", members: []string{"1", "2"}}
+	today := matchRecord{date: "2026-10-19", members: []string{"1", "2"}}
+	declined := matchRecord{date: "2026-10-19", members: []string{"1", "3"}, declined: []string{"1"}}
+
+	tests := []struct {
+		testName string
+		rec      Recurser
+		now      time.Time
+		records  []matchRecord
+		wanted   int
+	}{
+		{"only_yesterday", newYork, time.Date(2026, 10, 19, 15, 0, 0, 0, time.UTC), []matchRecord{yesterday}, 0},
+		// 05:00 on the 19th in Berlin, before the run for the 19th
+		{"before_the_run", berlin, time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC), []matchRecord{yesterday}, 0},
+		{"morning", newYork, time.Date(2026, 10, 19, 15, 0, 0, 0, time.UTC), []matchRecord{yesterday, today}, 1},
+		// 12:00, 16:00 and 23:00 on the 19th in New York
+		{"noon", newYork, time.Date(2026, 10, 19, 16, 0, 0, 0, time.UTC), []matchRecord{yesterday, today}, 1},
+		{"afternoon", newYork, time.Date(2026, 10, 19, 20, 0, 0, 0, time.UTC), []matchRecord{yesterday, today}, 1},
+		{"evening", newYork, time.Date(2026, 10, 20, 3, 0, 0, 0, time.UTC), []matchRecord{yesterday, today}, 1},
+		{"already_declined", newYork, time.Date(2026, 10, 19, 15, 0, 0, 0, time.UTC), []matchRecord{declined}, 0},
+		// it's the 20th in Tokyo, which the run on the 19th was for
+		{"tokyo", tokyo, time.Date(2026, 10, 19, 15, 0, 0, 0, time.UTC), []matchRecord{yesterday, today}, 1},
+		{"tokyo_evening", tokyo, time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC), []matchRecord{yesterday, today}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			if got := todaysMatches(tt.records, tt.rec, tt.now); len(got) != tt.wanted {
+				t.Errorf("got %v matches, wanted %v\n", len(got), tt.wanted)
+			}
+		})
+	}
+}
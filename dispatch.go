@@ -3,11 +3,14 @@ package main
 import (
 	"context"
 	"fmt"
-	"strings"
+	"log"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
-const helpMessage string = "**How to use Pairing Bot:**\n* `subscribe` to start getting matched with other Pairing Bot users for pair programming\n* `schedule monday wednesday friday` to set your weekly pairing schedule\n  * In this example, I've been set to find pairing partners for you on every Monday, Wednesday, and Friday\n  * You can schedule pairing for any combination of days in the week\n* `streams` to select streams/topics of the match and to select the number of pairings per keyword\n  * For example, `streams any 2 pairing 1 math 1` would schedule per day 2 pairings with anyone, 1 pairing with someone interesting in pair programming, and 1 pairing with someone who'd like to talk about math. Of course, they would need to be available on a given day.\n  * At the moment, there's no strict rules for words as topics here except that they have to be one word. I suggest using the stream name without the spaces!\n* `skip tomorrow` to skip pairing tomorrow\n  * This is valid until matches go out at 04:00 UTC\n* `unskip tomorrow` to undo skipping tomorrow\n* `status` to show your current schedule, skip status, and name\n* `unsubscribe` to stop getting matched entirely\n\nIf you've found a bug, please [submit an issue on github](https://github.com/thwidge/pairing-bot/issues)!"
+const helpMessage string = "**How to use Pairing Bot:**\n* `subscribe` to start getting matched with other Pairing Bot users for pair programming\n* `schedule monday wednesday friday` to set your weekly pairing schedule\n  * In this example, I've been set to find pairing partners for you on every Monday, Wednesday, and Friday\n  * You can schedule pairing for any combination of days in the week\n* `streams` to select streams/topics of the match and to select the number of pairings per keyword\n  * For example, `streams any 2 pairing 1 math 1` would schedule per day 2 pairings with anyone, 1 pairing with someone interesting in pair programming, and 1 pairing with someone who'd like to talk about math. Of course, they would need to be available on a given day.\n  * Put the streams that matter most to you first: I try to match streams in the order people list them, and the streams with the fewest people before the popular ones\n  * Topics are Zulip stream names, or `any`. Put stream names with spaces in quotes, like `streams \"data science\" 1`, or mention the stream, like `streams #**data science** 1`\n  * Start with a day to set streams for just that day, like `streams monday rust 1` or `streams friday any 2`. `streams friday default` goes back to your usual streams on Fridays\n* `topics` to see which streams other people are pairing in, and on which days\n* `languages go rust python` to tell me which programming languages you'd like to pair in\n  * I'll try to match you with people who share some of them, and tell you which ones when you're matched. `languages none` clears them\n* `timezone America/Los_Angeles` to set your time zone\n  * Your schedule's days are your own local days, and you're only matched with people on the same day. Until you set it, I assume you're in New York\n* `hours 10:00-16:00` to set when you're free each day, in your time zone\n  * I'll only match you with people whose hours overlap with yours. `hours any` means you're free all day\n* `skip tomorrow` to skip pairing tomorrow\n  * This is valid until matches go out at 04:00 UTC\n  * You can skip other days too, like `skip friday`, `skip next week`, `skip 2026-10-21` or `skip 10/20-10/24`\n* `unskip tomorrow` to undo skipping tomorrow\n  * This works with other days too, and `unskip all` undoes all of them\n* `skips` to see which days you're skipping\n* `pause` to stop being matched for a while, without losing your settings\n  * `pause until 2026-11-02` (or `pause until friday`) to start again automatically on that day, or `resume` whenever you're back\n* `status` to show your current schedule, skip status, and name\n* `history` to see who you've paired with, and when\n  * `history 30d` shows just the last 30 days. Long histories come in pages: `history page 2`\n* `block @**Their Name**` to never be matched with someone. They won't be told\n  * `unblock @**Their Name**` to undo it, and `blocked` to see who you've blocked\n* `prefer @**Their Name**` to ask to be matched with someone\n  * If they `prefer` you too, I'll match you together on days you're both scheduled\n  * `unprefer @**Their Name**` to undo it\n* `level beginner`, `level intermediate` or `level experienced` to tell me how experienced you are\n  * `levels similar` to be matched with people at about your level, `levels across` for people at other levels, or `levels any` if you don't mind\n  * `role mentor` or `role mentee` if you'd like to mentor or be mentored, or `role peer` to go back to being matched as equals\n* `yes`, `no` or `rate 1` to `rate 5` to tell me whether you paired with your last match, and how it went\n  * I'll ask every evening after you've been matched. If people keep not showing up, I match them last\n* `pair now` to be matched with the next person who asks in the next little while\n  * `pair now rust` to pair in a stream. People who just say `pair now` can be matched with anyone\n* `decline` (or `cancel today`) if you can't make it to today's match\n  * I'll tell your partner, and try to find them someone else who's free\n* `noshow` to tell me your last partner never showed up (or `noshow @**Their Name**` if you had a few)\n  * If enough different partners report someone, I pause their matches until they `resume`. They're never told who reported them\n* `unsubscribe` to stop getting matched entirely\n\nIf you've found a bug, please [submit an issue on github](https://github.com/thwidge/pairing-bot/issues)!"
 const subscribeMessage string = "Yay! You're now subscribed to Pairing Bot!\nCurrently, I'm set to find pair programming partners for you on **Mondays**, **Tuesdays**, **Wednesdays**, **Thursdays**, and **Fridays**.\nYou can customize your schedule any time with `schedule` :)"
 const unsubscribeMessage string = "You're unsubscribed!\nI won't find pairing partners for you unless you `subscribe`.\n\nBe well :)"
 const notSubscribedMessage string = "You're not subscribed to Pairing Bot <3"
@@ -64,22 +67,76 @@ func dispatch(ctx context.Context, pl *PairingLogic, cmd string, cmdArgs []strin
 			response = notSubscribedMessage
 			break
 		}
+		// the streams might just be for one day of the week
+		var day string
+		if weekday(cmdArgs[0]) != -1 {
+			day, cmdArgs = cmdArgs[0], cmdArgs[1:]
+		}
+		// make sure the streams exist, so a typo doesn't make a stream nobody else is in.
+		// if zulip can't tell us, it's better to take them as they are than to fail
+		if len(cmdArgs) > 1 {
+			botPassword, keyErr := pl.adb.GetKey(ctx, "apiauth", "key")
+			if keyErr != nil {
+				log.Println("Something weird happened trying to read the auth token from the database")
+			}
+			zulipStreams, listErr := pl.sl.listStreams(ctx, botPassword)
+			if listErr != nil {
+				log.Printf("Could not get the list of streams from zulip: %s\n", listErr)
+			}
+			if len(zulipStreams) > 0 {
+				var names []string
+				for i := 0; i < len(cmdArgs); i += 2 {
+					names = append(names, cmdArgs[i])
+				}
+				found, problem := checkStreams(names, zulipStreams)
+				if problem != "" {
+					response = problem
+					break
+				}
+				for i := range found {
+					cmdArgs[2*i] = found[i]
+				}
+			}
+		}
 		// convert arguments to map from stream to number of pairings per day in that stream
+		// the order they're given in is kept too, since that's their priority
 		var newStreams = map[string]int{}
-		for i := 0; i < len(cmdArgs); i += 2{
+		var newStreamOrder []string
+		for i := 0; i+1 < len(cmdArgs); i += 2 {
 			// convert string to number
-			count, _ := strconv.Atoi(cmdArgs[i + 1])
+			count, _ := strconv.Atoi(cmdArgs[i+1])
 			// store
+			if _, ok := newStreams[cmdArgs[i]]; !ok {
+				newStreamOrder = append(newStreamOrder, cmdArgs[i])
+			}
 			newStreams[cmdArgs[i]] = count
 		}
 		// put it in the database
-		rec.streams = newStreams
+		switch {
+		case day == "":
+			rec.streams = newStreams
+			rec.streamOrder = newStreamOrder
+			response = "Awesome, your topic's been set! You can check it with `status`."
+		case cmdArgs[0] == "default":
+			delete(rec.dayStreams, day)
+			delete(rec.dayStreamOrder, day)
+			response = fmt.Sprintf("OK, you're back to your usual streams on %vs.", weekday(day))
+		default:
+			if rec.dayStreams == nil {
+				rec.dayStreams = make(map[string]map[string]int)
+				rec.dayStreamOrder = make(map[string][]string)
+			}
+			rec.dayStreams[day] = newStreams
+			rec.dayStreamOrder[day] = newStreamOrder
+			// there's no point setting streams for a day they don't pair on
+			rec.schedule[day] = true
+			response = fmt.Sprintf("Awesome, your topics for %vs have been set! You can see your week with `status`, and go back to your usual streams with `streams %v default`.", weekday(day), day)
+		}
 
 		if err = pl.rdb.Set(ctx, userID, rec); err != nil {
 			response = writeErrorMessage
 			break
 		}
-		response = "Awesome, your topic's been set! You can check it with `status`."
 
 	case "subscribe":
 		if isSubscribed {
@@ -110,27 +167,146 @@ func dispatch(ctx context.Context, pl *PairingLogic, cmd string, cmdArgs []strin
 			response = notSubscribedMessage
 			break
 		}
+		now := time.Now()
+		dates, dateErr := parseDates(cmdArgs[0], now.In(rec.location()))
+		if dateErr != nil {
+			response = fmt.Sprintf("Hmm, %v. Try something like `skip friday` or `skip 10/20-10/24`.", dateErr)
+			break
+		}
+		today := now.In(rec.location()).Format(dateLayout)
+		var added []string
+		for _, date := range dates {
+			if d := date.Format(dateLayout); d >= today {
+				added = append(added, d)
+			}
+		}
+		if len(added) == 0 {
+			response = "That's already happened!"
+			break
+		}
+		rec.skipping = append(rec.skipping, added...)
+		rec.skipping = rec.upcomingSkips(now)
 
-		rec.isSkippingTomorrow = true
-
-		if err := pl.rdb.Set(ctx, userID, rec); err != nil {
+		if err = pl.rdb.Set(ctx, userID, rec); err != nil {
 			response = writeErrorMessage
 			break
 		}
-		response = `Tomorrow: cancelled. I feel you. **I will not match you** for pairing tomorrow <3`
+		if cmdArgs[0] == "tomorrow" {
+			response = `Tomorrow: cancelled. I feel you. **I will not match you** for pairing tomorrow <3`
+		} else {
+			response = fmt.Sprintf("Cancelled. I feel you. **I will not match you** for pairing on %v <3 You can see all your skips with `skips`.", formatDates(added))
+		}
 
 	case "unskip":
 		if !isSubscribed {
 			response = notSubscribedMessage
 			break
 		}
-		rec.isSkippingTomorrow = false
+		now := time.Now()
+		var removed []string
+		if cmdArgs[0] == "all" {
+			removed = rec.upcomingSkips(now)
+			rec.skipping = nil
+		} else {
+			dates, dateErr := parseDates(cmdArgs[0], now.In(rec.location()))
+			if dateErr != nil {
+				response = fmt.Sprintf("Hmm, %v. Try something like `unskip friday` or `unskip 10/20-10/24`.", dateErr)
+				break
+			}
+			var kept []string
+			for _, skipped := range rec.upcomingSkips(now) {
+				unskipped := false
+				for _, date := range dates {
+					if date.Format(dateLayout) == skipped {
+						unskipped = true
+					}
+				}
+				if unskipped {
+					removed = append(removed, skipped)
+				} else {
+					kept = append(kept, skipped)
+				}
+			}
+			rec.skipping = kept
+		}
+		if len(removed) == 0 {
+			response = "You weren't skipping any of those days. You can see your skips with `skips`."
+			break
+		}
 
-		if err := pl.rdb.Set(ctx, userID, rec); err != nil {
+		if err = pl.rdb.Set(ctx, userID, rec); err != nil {
 			response = writeErrorMessage
 			break
 		}
-		response = "Tomorrow: uncancelled! Heckin *yes*! **I will match you** for pairing tomorrow :)"
+		if cmdArgs[0] == "tomorrow" {
+			response = "Tomorrow: uncancelled! Heckin *yes*! **I will match you** for pairing tomorrow :)"
+		} else {
+			response = fmt.Sprintf("Uncancelled! Heckin *yes*! **I will match you** for pairing on %v, if they're on your schedule :)", formatDates(removed))
+		}
+
+	case "skips":
+		if !isSubscribed {
+			response = notSubscribedMessage
+			break
+		}
+		skips := rec.upcomingSkips(time.Now())
+		if len(skips) == 0 {
+			response = "You're not skipping any days. Use `skip` to skip some!"
+			break
+		}
+		response = "I won't match you on:\n* " + strings.Join(dateRuns(skips), "\n* ") + "\n\nUse `unskip` to undo any of them."
+
+	case "pause":
+		if !isSubscribed {
+			response = notSubscribedMessage
+			break
+		}
+		rec.paused = true
+		rec.pausedUntil = ""
+		if len(cmdArgs) > 0 {
+			now := time.Now().In(rec.location())
+			dates, dateErr := parseDates(cmdArgs[0], now)
+			if dateErr != nil {
+				response = fmt.Sprintf("Hmm, %v. Try something like `pause until friday` or `pause until 2026-11-02`.", dateErr)
+				break
+			}
+			rec.pausedUntil = dates[0].Format(dateLayout)
+			if rec.pausedUntil <= now.Format(dateLayout) {
+				response = "That's not in the future! Use `pause` on its own to pause until you `resume`."
+				break
+			}
+		}
+
+		if err = pl.rdb.Set(ctx, userID, rec); err != nil {
+			response = writeErrorMessage
+			break
+		}
+		if rec.pausedUntil == "" {
+			response = "Paused! I'll hang on to your settings, but **I won't match you** until you send me `resume`. Take care <3"
+		} else {
+			response = fmt.Sprintf("Paused! I'll hang on to your settings, but **I won't match you** until %v, when I'll start again and let you know. You can `resume` sooner if you like. Take care <3", formatDates([]string{rec.pausedUntil}))
+		}
+
+	case "resume":
+		if !isSubscribed {
+			response = notSubscribedMessage
+			break
+		}
+		if !rec.paused && !rec.suspended {
+			response = "You're not paused! I'm already matching you on your schedule."
+			break
+		}
+		rec.paused = false
+		rec.pausedUntil = ""
+		// coming back from a suspension is a fresh start
+		rec.suspended = false
+		rec.noShowReports = nil
+
+		if err = pl.rdb.Set(ctx, userID, rec); err != nil {
+			response = writeErrorMessage
+			break
+		}
+		response = "Welcome back! **I will match you** on your schedule again, starting with the next matches :)"
 
 	case "status":
 		if !isSubscribed {
@@ -153,10 +329,10 @@ func dispatch(ctx context.Context, pl *PairingLogic, cmd string, cmdArgs []strin
 
 		// get skip status and prepare to write a sentence with it
 		var skipStr string
-		if rec.isSkippingTomorrow {
-			skipStr = " "
+		if skips := rec.upcomingSkips(time.Now()); len(skips) > 0 {
+			skipStr = fmt.Sprintf("**You're set to skip** pairing on %v", formatDates(skips))
 		} else {
-			skipStr = " not "
+			skipStr = "**You're not set to skip** pairing on any days"
 		}
 
 		// make a sorted list of their schedule
@@ -180,33 +356,570 @@ func dispatch(ctx context.Context, pl *PairingLogic, cmd string, cmdArgs []strin
 		}
 
 		// get the streams they'd like to talk in and format string to insert
-		// streams are stored as a []string first to make sure "any" comes first and for easy formatting
+		// streams are stored as a []string first to keep them in their priority order and for easy formatting
 		var streams []string
-		if rec.streams["any"] > 0 {
-			streams = append(streams, "any")
+		for _, stream := range rec.streamOrder {
+			if rec.streams[stream] > 0 {
+				streams = append(streams, stream)
+			}
 		}
-		for stream, _ := range rec.streams {
-			if stream != "any" {
+		// older subscribers might not have a priority order saved yet
+		for _, stream := range recursersStreams(rec) {
+			if !contains(streams, stream) {
 				streams = append(streams, stream)
 			}
 		}
 		// make string print
 		var streamsStr string
 		for i, stream := range streams {
+			if streamsStr != "" {
+				streamsStr += ", "
+			}
+			if i > 0 && i == len(streams)-1 {
+				streamsStr += "and "
+			}
 			if stream == "any" {
 				streamsStr += fmt.Sprintf("%v pairings with any recurser", rec.streams[stream])
 			} else {
-				if streamsStr != "" {
-					streamsStr += ", "
+				streamsStr += fmt.Sprintf("%v pairings with a recurser from stream %v", rec.streams[stream], stream)
+			}
+		}
+
+		response = fmt.Sprintf("* You're %v\n* You're scheduled for pairing on **%v**\n We'll try and find you %v \n %v", whoami, scheduleStr, streamsStr, skipStr)
+
+		// some days have their own streams, so show the whole week
+		if len(rec.dayStreams) > 0 {
+			response += "\n* Here's your week:\n\n" + weeklyGrid(rec, schedule)
+		}
+
+		if rec.suspended {
+			response += "\n* **You're paused** because some of your partners said you didn't show up. Send me `resume` when you're ready to pair again"
+		} else if rec.paused && rec.pausedUntil == "" {
+			response += "\n* **You're paused** until you `resume`"
+		} else if rec.paused {
+			response += fmt.Sprintf("\n* **You're paused** until %v", formatDates([]string{rec.pausedUntil}))
+		}
+
+		response += fmt.Sprintf("\n* Your time zone is **%v**", rec.location())
+		if rec.hours != "" {
+			response += fmt.Sprintf("\n* You're free **%v** each day", rec.hours)
+		}
+
+		if rec.level != "" {
+			response += fmt.Sprintf("\n* You're **%v**", rec.level)
+		}
+		if rec.role == "mentor" || rec.role == "mentee" {
+			response += fmt.Sprintf("\n* You'd like to pair as a **%v**", rec.role)
+		}
+		if rec.levelMatch == "similar" {
+			response += "\n* You'd like partners at **similar** levels"
+		} else if rec.levelMatch == "across" {
+			response += "\n* You'd like partners at **different** levels"
+		}
+
+		if len(rec.languages) > 0 {
+			response += fmt.Sprintf("\n* You'd like to pair in %v", formatList(rec.languages))
+		}
+
+		// show who they've asked to pair with, and whether that's mutual yet
+		if len(rec.preferred) > 0 {
+			var recursersList []Recurser
+			recursersList, err = pl.rdb.GetAllUsers(ctx)
+			if err != nil {
+				response = readErrorMessage
+				break
+			}
+			byID := make(map[string]Recurser)
+			for _, r := range recursersList {
+				byID[r.id] = r
+			}
+			var prefs []string
+			for id, name := range rec.preferred {
+				if mutuallyPreferred(rec, byID[id]) {
+					prefs = append(prefs, fmt.Sprintf("%v (they'd like to pair with you too!)", name))
+				} else {
+					prefs = append(prefs, fmt.Sprintf("%v (pending until they `prefer` you too)", name))
+				}
+			}
+			sort.Strings(prefs)
+			response += "\n* You'd like to pair with " + strings.Join(prefs, ", ")
+		}
+
+	case "block":
+		if !isSubscribed {
+			response = notSubscribedMessage
+			break
+		}
+		var recursersList []Recurser
+		recursersList, err = pl.rdb.GetAllUsers(ctx)
+		if err != nil {
+			response = readErrorMessage
+			break
+		}
+		other, ok := findRecurser(recursersList, cmdArgs[0])
+		if !ok {
+			response = fmt.Sprintf("I couldn't find %v among Pairing Bot's users. Try mentioning them like `block @**Their Name**`", cmdArgs[0])
+			break
+		}
+		if other.id == userID {
+			response = "You can't block yourself, silly :)"
+			break
+		}
+		if rec.blocked == nil {
+			rec.blocked = make(map[string]string)
+		}
+		rec.blocked[other.id] = other.name
+		// blocking someone cancels wanting to pair with them
+		delete(rec.preferred, other.id)
+
+		if err = pl.rdb.Set(ctx, userID, rec); err != nil {
+			response = writeErrorMessage
+			break
+		}
+		response = fmt.Sprintf("Got it. **I will never match you with %v**. They won't be told about this. You can undo it with `unblock`.", other.name)
+
+	case "unblock":
+		if !isSubscribed {
+			response = notSubscribedMessage
+			break
+		}
+		// look through the people they've blocked, since whoever it is might not be subscribed anymore
+		var blockedList []Recurser
+		for id, name := range rec.blocked {
+			blockedList = append(blockedList, Recurser{id: id, name: name})
+		}
+		other, ok := findRecurser(blockedList, cmdArgs[0])
+		if !ok {
+			response = fmt.Sprintf("You haven't blocked %v. Send me `blocked` to see who you've blocked.", cmdArgs[0])
+			break
+		}
+		delete(rec.blocked, other.id)
+
+		if err = pl.rdb.Set(ctx, userID, rec); err != nil {
+			response = writeErrorMessage
+			break
+		}
+		response = fmt.Sprintf("OK, %v is unblocked. I might match you with them again.", other.name)
+
+	case "blocked":
+		if !isSubscribed {
+			response = notSubscribedMessage
+			break
+		}
+		if len(rec.blocked) == 0 {
+			response = "You haven't blocked anyone."
+			break
+		}
+		var names []string
+		for _, name := range rec.blocked {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		response = "I will never match you with:\n* " + strings.Join(names, "\n* ")
+
+	case "prefer":
+		if !isSubscribed {
+			response = notSubscribedMessage
+			break
+		}
+		var recursersList []Recurser
+		recursersList, err = pl.rdb.GetAllUsers(ctx)
+		if err != nil {
+			response = readErrorMessage
+			break
+		}
+		other, ok := findRecurser(recursersList, cmdArgs[0])
+		if !ok {
+			response = fmt.Sprintf("I couldn't find %v among Pairing Bot's users. Try mentioning them like `prefer @**Their Name**`", cmdArgs[0])
+			break
+		}
+		if other.id == userID {
+			response = "You'll always be your own best pair, but I can't match you with yourself :)"
+			break
+		}
+		if _, ok := rec.blocked[other.id]; ok {
+			response = fmt.Sprintf("You've blocked %v. You'll need to `unblock` them first.", other.name)
+			break
+		}
+		if rec.preferred == nil {
+			rec.preferred = make(map[string]string)
+		}
+		rec.preferred[other.id] = other.name
+
+		if err = pl.rdb.Set(ctx, userID, rec); err != nil {
+			response = writeErrorMessage
+			break
+		}
+		if mutuallyPreferred(rec, other) {
+			response = fmt.Sprintf("You and %v both want to pair with each other, so **I'll match you together** whenever you're both scheduled :)", other.name)
+		} else {
+			response = fmt.Sprintf("Noted! If %v sends me `prefer` for you too, I'll match you together whenever you're both scheduled. Until then it's pending; you can see it with `status`.", other.name)
+		}
+
+	case "unprefer":
+		if !isSubscribed {
+			response = notSubscribedMessage
+			break
+		}
+		var preferredList []Recurser
+		for id, name := range rec.preferred {
+			preferredList = append(preferredList, Recurser{id: id, name: name})
+		}
+		other, ok := findRecurser(preferredList, cmdArgs[0])
+		if !ok {
+			response = fmt.Sprintf("You haven't asked to pair with %v. You can see who you have with `status`.", cmdArgs[0])
+			break
+		}
+		delete(rec.preferred, other.id)
+
+		if err = pl.rdb.Set(ctx, userID, rec); err != nil {
+			response = writeErrorMessage
+			break
+		}
+		response = fmt.Sprintf("OK, I'll stop trying to match you with %v.", other.name)
+
+	case "level":
+		if !isSubscribed {
+			response = notSubscribedMessage
+			break
+		}
+		rec.level = cmdArgs[0]
+
+		if err = pl.rdb.Set(ctx, userID, rec); err != nil {
+			response = writeErrorMessage
+			break
+		}
+		response = fmt.Sprintf("Got it, you're **%v**. Use `levels similar` or `levels across` to tell me who you'd like to be matched with.", rec.level)
+
+	case "role":
+		if !isSubscribed {
+			response = notSubscribedMessage
+			break
+		}
+		rec.role = cmdArgs[0]
+
+		if err = pl.rdb.Set(ctx, userID, rec); err != nil {
+			response = writeErrorMessage
+			break
+		}
+		switch rec.role {
+		case "mentor":
+			response = "Thanks for helping out! I'll try to match you with mentees who are less experienced than you."
+		case "mentee":
+			response = "Got it! I'll try to match you with mentors who are more experienced than you."
+		default:
+			response = "Got it! I'll match you as a peer."
+		}
+
+	case "levels":
+		if !isSubscribed {
+			response = notSubscribedMessage
+			break
+		}
+		rec.levelMatch = cmdArgs[0]
+
+		if err = pl.rdb.Set(ctx, userID, rec); err != nil {
+			response = writeErrorMessage
+			break
+		}
+		switch rec.levelMatch {
+		case "similar":
+			response = "Got it! I'll try to match you with people at about your level."
+		case "across":
+			response = "Got it! I'll try to match you with people at a different level from you."
+		default:
+			response = "Got it! I won't look at levels when matching you."
+		}
+		if rec.level == "" {
+			response += " Don't forget to tell me your own level with `level`."
+		}
+
+	case "languages":
+		if !isSubscribed {
+			response = notSubscribedMessage
+			break
+		}
+		if len(cmdArgs) == 1 && cmdArgs[0] == "none" {
+			rec.languages = nil
+		} else {
+			rec.languages = nil
+			for _, language := range cmdArgs {
+				if !contains(rec.languages, language) {
+					rec.languages = append(rec.languages, language)
 				}
-				if i == len(streams) - 1 {
-					streamsStr += "and "
+			}
+		}
+
+		if err = pl.rdb.Set(ctx, userID, rec); err != nil {
+			response = writeErrorMessage
+			break
+		}
+		if len(rec.languages) == 0 {
+			response = "OK, I won't look at languages when matching you."
+		} else {
+			response = fmt.Sprintf("Awesome, I'll try to match you with people who also like %v. You can check it with `status`.", formatList(rec.languages))
+		}
+
+	case "timezone":
+		if !isSubscribed {
+			response = notSubscribedMessage
+			break
+		}
+		tz, ok := findTimezone(cmdArgs[0])
+		if !ok {
+			response = fmt.Sprintf("I don't know the time zone %v. Try a name from [this list](https://en.wikipedia.org/wiki/List_of_tz_database_time_zones), like `timezone America/Los_Angeles` or `timezone Europe/Berlin`.", cmdArgs[0])
+			break
+		}
+		rec.timezone = tz
+
+		if err = pl.rdb.Set(ctx, userID, rec); err != nil {
+			response = writeErrorMessage
+			break
+		}
+		response = fmt.Sprintf("Got it, your time zone is **%v**. Your schedule's days are now your own local days, and I'll only match you with people on the same day as you.", tz)
+
+	case "hours":
+		if !isSubscribed {
+			response = notSubscribedMessage
+			break
+		}
+		if cmdArgs[0] == "any" {
+			rec.hours = ""
+		} else {
+			rec.hours = cmdArgs[0]
+		}
+
+		if err = pl.rdb.Set(ctx, userID, rec); err != nil {
+			response = writeErrorMessage
+			break
+		}
+		if rec.hours == "" {
+			response = "Got it, I'll match you with people no matter when they're free."
+		} else {
+			response = fmt.Sprintf("Got it, you're free **%v %v**. I'll only match you with people who are free at the same time for at least a bit.", rec.hours, rec.location())
+		}
+
+	case "preview":
+		// admin-only, so everyone else just gets the help message
+		if !isAdmin(userID) {
+			response = helpMessage
+			break
+		}
+		var preview matchPreview
+		preview, err = pl.previewMatches(ctx, previewSeed)
+		if err != nil {
+			response = readErrorMessage
+			break
+		}
+		response = preview.String()
+
+	case "history":
+		// they might have unsubscribed since, but their matches still happened
+		days, page, _ := parseHistoryArgs(cmdArgs)
+		var since string
+		if days > 0 {
+			since = time.Now().AddDate(0, 0, -days).Format(dateLayout)
+		}
+		var records []matchRecord
+		records, err = pl.mdb.ListForUser(ctx, userID, since)
+		if err != nil {
+			response = readErrorMessage
+			break
+		}
+		response = formatHistory(records, userID, days, page)
+
+	case "feedback":
+		since := time.Now().AddDate(0, 0, -feedbackDays).Format(dateLayout)
+		var records []matchRecord
+		records, err = pl.mdb.ListForUser(ctx, userID, since)
+		if err != nil {
+			response = readErrorMessage
+			break
+		}
+		records = pairedMatches(records, userID)
+		var latest string
+		for _, record := range records {
+			if record.date > latest {
+				latest = record.date
+			}
+		}
+		if latest == "" {
+			response = "I don't have a recent match for you to give feedback on. Thanks anyway!"
+			break
+		}
+		for _, record := range records {
+			if record.date != latest {
+				continue
+			}
+			if err = pl.mdb.SetFeedback(ctx, record.id, userID, cmdArgs[0]); err != nil {
+				response = writeErrorMessage
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+		switch cmdArgs[0] {
+		case "yes":
+			response = "Yay! Thanks for letting me know :)"
+		case "no":
+			response = "Aw, sorry it didn't work out. Thanks for letting me know <3"
+		case "1", "2":
+			response = fmt.Sprintf("Thanks for rating your pairing %v/5. Sorry it wasn't great <3", cmdArgs[0])
+		default:
+			response = fmt.Sprintf("Thanks for rating your pairing %v/5! :)", cmdArgs[0])
+		}
+
+	case "noshow":
+		// it's about someone from their most recent match
+		since := time.Now().AddDate(0, 0, -feedbackDays).Format(dateLayout)
+		var records []matchRecord
+		records, err = pl.mdb.ListForUser(ctx, userID, since)
+		if err != nil {
+			response = readErrorMessage
+			break
+		}
+		records = pairedMatches(records, userID)
+		var latest string
+		for _, record := range records {
+			if record.date > latest {
+				latest = record.date
+			}
+		}
+		// everyone they were matched with that day, and which match it was.
+		// people who declined aren't no-shows
+		var partners []Recurser
+		partnerRecords := make(map[string]matchRecord)
+		for _, record := range records {
+			if record.date != latest {
+				continue
+			}
+			for _, id := range record.active() {
+				if _, ok := partnerRecords[id]; !ok && id != userID {
+					partners = append(partners, Recurser{id: id, name: record.names[id]})
+					partnerRecords[id] = record
 				}
-				streamsStr += fmt.Sprintf("%v pairings with a recurser from stream %v", rec.streams[stream], stream)
 			}
 		}
+		if len(partners) == 0 {
+			response = "I don't have a recent match for you to report. Thanks anyway!"
+			break
+		}
+
+		var other Recurser
+		switch {
+		case len(cmdArgs) > 0:
+			var ok bool
+			if other, ok = findRecurser(partners, cmdArgs[0]); !ok {
+				response = fmt.Sprintf("You weren't matched with %v in your last match.", cmdArgs[0])
+			}
+		case len(partners) == 1:
+			other = partners[0]
+		default:
+			var names []string
+			for _, p := range partners {
+				names = append(names, p.name)
+			}
+			response = fmt.Sprintf("You were matched with %v. Who didn't show up? Send me `noshow @**Their Name**`.", joinAnd(names))
+		}
+		if other.id == "" {
+			break
+		}
 
-		response = fmt.Sprintf("* You're %v\n* You're scheduled for pairing on **%v**\n We'll try and find you %v \n **You're%vset to skip** pairing tomorrow", whoami, scheduleStr, streamsStr, skipStr)
+		// it counts as them not pairing, too
+		if err = pl.mdb.SetFeedback(ctx, partnerRecords[other.id].id, userID, "no"); err != nil {
+			response = writeErrorMessage
+			break
+		}
+
+		var recursersList []Recurser
+		recursersList, err = pl.rdb.GetAllUsers(ctx)
+		if err != nil {
+			response = readErrorMessage
+			break
+		}
+		var offender Recurser
+		for _, r := range recursersList {
+			if r.id == other.id {
+				offender = r
+			}
+		}
+		response = fmt.Sprintf("Sorry %v didn't show up :( Thanks for letting me know.", other.name)
+		// they've unsubscribed since, or they've already been reported by this person
+		if offender.id == "" {
+			break
+		}
+		if _, ok := offender.noShowReports[userID]; ok {
+			break
+		}
+		if offender.noShowReports == nil {
+			offender.noShowReports = make(map[string]string)
+		}
+		offender.noShowReports[userID] = latest
+		suspending := !offender.suspended && len(offender.noShowReports) >= noShowLimit
+		if suspending {
+			offender.suspended = true
+		}
+
+		if err = pl.rdb.Set(ctx, offender.id, offender); err != nil {
+			response = writeErrorMessage
+			break
+		}
+		if suspending {
+			botPassword, keyErr := pl.adb.GetKey(ctx, "apiauth", "key")
+			if keyErr != nil {
+				log.Println("Something weird happened trying to read the auth token from the database")
+			}
+			message := fmt.Sprintf(suspendedMessage, len(offender.noShowReports))
+			if sendErr := pl.un.sendUserMessage(ctx, botPassword, offender.email, message); sendErr != nil {
+				log.Printf("Error when trying to send suspended message to %s: %s\n", offender.email, sendErr)
+			}
+		}
+
+	case "decline":
+		// they might have unsubscribed since they were matched, but their partner still needs to know
+		response, err = pl.decline(ctx, rec)
+
+	case "pair":
+		if !isSubscribed {
+			response = notSubscribedMessage
+			break
+		}
+		if rec.suspended {
+			response = "Your matches are paused because partners told me you didn't show up. Send me `resume` when you're ready to pair again!"
+			break
+		}
+		response, err = pl.pairNow(ctx, rec, cmdArgs[0])
+
+	case "topics":
+		// anyone can look, since it might help them decide to subscribe
+		var recursersList []Recurser
+		recursersList, err = pl.rdb.GetAllUsers(ctx)
+		if err != nil {
+			response = readErrorMessage
+			break
+		}
+		// people who are paused aren't pairing on anything right now
+		var active []Recurser
+		for _, r := range recursersList {
+			if !r.isPaused(time.Now()) {
+				active = append(active, r)
+			}
+		}
+		topics := listTopics(active)
+		if len(topics) == 0 {
+			response = "Nobody's pairing on anything yet!"
+			break
+		}
+		response = "Here's what people are pairing on:"
+		for _, t := range topics {
+			response += "\n* " + t.String()
+		}
+		example := topics[0].stream
+		if strings.Contains(example, " ") {
+			example = `"` + example + `"`
+		}
+		response += fmt.Sprintf("\n\nJoin one with `streams`, like `streams %v 1`. Streams with only one person never get matched!", example)
 
 	case "help":
 		response = helpMessage
@@ -216,3 +929,85 @@ func dispatch(ctx context.Context, pl *PairingLogic, cmd string, cmdArgs []strin
 	}
 	return response, err
 }
+
+// pairedMatches leaves out the matches that were cancelled for the user:
+// the ones they declined, and the ones everyone else declined
+func pairedMatches(records []matchRecord, userID string) []matchRecord {
+	var paired []matchRecord
+	for _, record := range records {
+		if !contains(record.declined, userID) && len(record.active()) > 1 {
+			paired = append(paired, record)
+		}
+	}
+	return paired
+}
+
+// weeklyGrid is a table of how many pairings a recurser wants in each
+// stream on each of the given days ("Monday")
+func weeklyGrid(rec Recurser, days []string) string {
+	// their usual streams first, in their order, then any others
+	var columns []string
+	for _, stream := range rec.streamOrder {
+		if rec.streams[stream] > 0 {
+			columns = append(columns, stream)
+		}
+	}
+	var others []string
+	for _, day := range days {
+		streams, _ := rec.streamsOn(strings.ToLower(day))
+		for stream, count := range streams {
+			if count > 0 && !contains(columns, stream) && !contains(others, stream) {
+				others = append(others, stream)
+			}
+		}
+	}
+	sort.Strings(others)
+	columns = append(columns, others...)
+
+	grid := "| |"
+	for _, stream := range columns {
+		grid += " `" + stream + "` |"
+	}
+	grid += "\n|---|" + strings.Repeat("---|", len(columns))
+	for _, day := range days {
+		streams, _ := rec.streamsOn(strings.ToLower(day))
+		grid += "\n| " + day + " |"
+		for _, stream := range columns {
+			if streams[stream] > 0 {
+				grid += fmt.Sprintf(" %v |", streams[stream])
+			} else {
+				grid += "  |"
+			}
+		}
+	}
+	return grid
+}
+
+// findRecurser finds who a user is talking about in a command. They could
+// have used a zulip mention (@**Jane Doe**, or @**Jane Doe|1234** when names
+// are ambiguous), an email address, or just a name.
+// The command has been lowercased by parseCmd, so this is case-insensitive
+func findRecurser(recursers []Recurser, who string) (Recurser, bool) {
+	who = strings.TrimPrefix(who, "@")
+	who = strings.TrimPrefix(who, "_")
+	who = strings.TrimPrefix(who, "**")
+	who = strings.TrimSuffix(who, "**")
+	who = strings.TrimSpace(who)
+
+	var id string
+	if i := strings.LastIndex(who, "|"); i != -1 {
+		who, id = who[:i], who[i+1:]
+	}
+
+	for _, r := range recursers {
+		switch {
+		case id != "":
+			if r.id == id {
+				return r, true
+			}
+		case strings.EqualFold(r.name, who) || strings.EqualFold(r.email, who):
+			return r, true
+		}
+	}
+	return Recurser{}, false
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// how many matches `history` shows at a time
+const historyPageSize = 10
+
+// parseHistoryArgs reads the arguments to `history`: how far back to go, like
+// 30d (0 days means all of it), and which page, like page 2
+func parseHistoryArgs(args []string) (days int, page int, ok bool) {
+	page = 1
+	if len(args) > 0 && args[0] != "page" {
+		if args[0] != "all" {
+			if !strings.HasSuffix(args[0], "d") {
+				return 0, 0, false
+			}
+			n, err := strconv.Atoi(strings.TrimSuffix(args[0], "d"))
+			if err != nil || n <= 0 {
+				return 0, 0, false
+			}
+			days = n
+		}
+		args = args[1:]
+	}
+	if len(args) > 0 {
+		if len(args) != 2 || args[0] != "page" {
+			return 0, 0, false
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		page = n
+	}
+	return days, page, true
+}
+
+// formatHistory lists one page of someone's matches, newest first, with who
+// else was in each one
+func formatHistory(records []matchRecord, userID string, days, page int) string {
+	if len(records) == 0 {
+		if days > 0 {
+			return fmt.Sprintf("You haven't been matched with anyone in the last %v days.", days)
+		}
+		return "You haven't been matched with anyone yet."
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].date != records[j].date {
+			return records[i].date > records[j].date
+		}
+		return records[i].stream < records[j].stream
+	})
+
+	pages := (len(records) + historyPageSize - 1) / historyPageSize
+	if page > pages {
+		return fmt.Sprintf("There are only %v pages of matches.", pages)
+	}
+
+	msg := "Here's who you've paired with"
+	if days > 0 {
+		msg += fmt.Sprintf(" in the last %v days", days)
+	}
+	if pages > 1 {
+		msg += fmt.Sprintf(" (page %v of %v)", page, pages)
+	}
+	msg += ":"
+
+	first := (page - 1) * historyPageSize
+	last := first + historyPageSize
+	if last > len(records) {
+		last = len(records)
+	}
+	for _, record := range records[first:last] {
+		var partners []string
+		for _, id := range record.members {
+			if id != userID {
+				partners = append(partners, record.names[id])
+			}
+		}
+		and := joinAnd(partners)
+		if len(record.active()) < 2 || contains(record.declined, userID) {
+			and += " (cancelled)"
+		}
+		msg += fmt.Sprintf("\n* %v in `%v`: %v", formatDates([]string{record.date}), record.stream, and)
+	}
+
+	if page < pages {
+		next := "history"
+		if days > 0 {
+			next += fmt.Sprintf(" %vd", days)
+		}
+		msg += fmt.Sprintf("\n\nSend `%v page %v` for more.", next, page+1)
+	}
+	return msg
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseHistoryArgs(t *testing.T) {
+	var tableParseHistoryArgs = []struct {
+		args []string
+		days int
+		page int
+		ok   bool
+	}{
+		{nil, 0, 1, true},
+		{[]string{"30d"}, 30, 1, true},
+		{[]string{"all"}, 0, 1, true},
+		{[]string{"page", "3"}, 0, 3, true},
+		{[]string{"7d", "page", "2"}, 7, 2, true},
+		{[]string{"0d"}, 0, 0, false},
+		{[]string{"30"}, 0, 0, false},
+		{[]string{"30d", "2"}, 0, 0, false},
+		{[]string{"page", "0"}, 0, 0, false},
+	}
+	for _, tt := range tableParseHistoryArgs {
+		days, page, ok := parseHistoryArgs(tt.args)
+		if days != tt.days || page != tt.page || ok != tt.ok {
+			t.Errorf("parseHistoryArgs(%q) got %v, %v, %v, wanted %v, %v, %v\n", tt.args, days, page, ok, tt.days, tt.page, tt.ok)
+		}
+	}
+}
+
+func TestFormatHistory(t *testing.T) {
+	var records []matchRecord
+	for day := 1; day <= 12; day++ {
+		records = append(records, matchRecord{
+			date:    fmt.Sprintf("2026-10-%02d", day),
+			stream:  "any",
+			members: []string{"me", "them"},
+			names:   map[string]string{"me": "Me", "them": fmt.Sprintf("Person %v", day)},
+		})
+	}
+	records = append(records, matchRecord{
+		date:    "2026-10-12",
+		stream:  "rust",
+		members: []string{"a", "me", "b"},
+		names:   map[string]string{"a": "Ada", "me": "Me", "b": "Bo"},
+	})
+
+	first := formatHistory(records, "me", 30, 1)
+	for _, want := range []string{"(page 1 of 2)", "* Monday, October 12 in `any`: Person 12", "* Monday, October 12 in `rust`: Ada and Bo", "`history 30d page 2`"} {
+		if !strings.Contains(first, want) {
+			t.Errorf("page 1 is missing %q:\n%v\n", want, first)
+		}
+	}
+	if strings.Contains(first, "Person 3\n") || strings.Count(first, "\n* ") != historyPageSize {
+		t.Errorf("page 1 should have the %v newest matches:\n%v\n", historyPageSize, first)
+	}
+
+	second := formatHistory(records, "me", 30, 2)
+	if strings.Count(second, "\n* ") != 3 || strings.Contains(second, "for more") {
+		t.Errorf("page 2 should have the last 3 matches:\n%v\n", second)
+	}
+}
@@ -2,18 +2,26 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
+	// so time zones work even where the system doesn't have the tz database
+	_ "time/tzdata"
 
 	"cloud.google.com/go/firestore"
 )
 
 // It's alive! The application starts here.
 func main() {
+	replayDate := flag.String("replay", "", "replay the matching for a past date (YYYY-MM-DD) and quit")
+	flag.Parse()
 
-	// setting up database connection: 2 clients encapsulated into PairingLogic struct
+	// setting up database connection: 3 clients encapsulated into PairingLogic struct
 
 	ctx := context.Background()
 
@@ -29,6 +37,12 @@ func main() {
 	}
 	defer ac.Close()
 
+	mc, err := firestore.NewClient(ctx, "pairing-bot-284823")
+	if err != nil {
+		log.Panic(err)
+	}
+	defer mc.Close()
+
 	rdb := &FirestoreRecurserDB{
 		client: rc,
 	}
@@ -37,6 +51,10 @@ func main() {
 		client: ac,
 	}
 
+	mdb := &FirestoreMatchHistoryDB{
+		client: mc,
+	}
+
 	ur := &zulipUserRequest{}
 
 	un := &zulipUserNotification{
@@ -44,17 +62,60 @@ func main() {
 		zulipAPIURL: "https://recurse.zulipchat.com/api/v1/messages",
 	}
 
+	sl := &zulipStreamLister{
+		botUsername: "pairing-bot@recurse.zulipchat.com",
+		zulipAPIURL: "https://recurse.zulipchat.com/api/v1/streams",
+	}
+
+	// the streams where an odd one out joins a pair instead of being left out
+	trioStreams := newStreamSet("*")
+	if t, ok := os.LookupEnv("PB_TRIO_STREAMS"); ok {
+		trioStreams = newStreamSet(t)
+	}
+
+	// how many minutes people's `hours` have to overlap for them to be matched
+	minOverlap := 60
+	if o, ok := os.LookupEnv("PB_MIN_OVERLAP_MINUTES"); ok {
+		minutes, err := strconv.Atoi(o)
+		if err != nil || minutes < 0 {
+			log.Printf("Ignoring bad PB_MIN_OVERLAP_MINUTES %q", o)
+		} else {
+			minOverlap = minutes
+		}
+	}
+
+	// which matching algorithm to use: random, history or priority
+	matcherName := "priority"
+	if m, ok := os.LookupEnv("PB_MATCHER"); ok {
+		matcherName = m
+	}
+	config := matcherConfig{
+		trioStreams: trioStreams,
+		minOverlap:  time.Duration(minOverlap) * time.Minute,
+	}
+	matcher, err := newMatcher(matcherName, config)
+	if err != nil {
+		log.Panic(err)
+	}
+
 	pl := &PairingLogic{
 		rdb: rdb,
 		adb: adb,
+		mdb: mdb,
 		ur:  ur,
 		un:  un,
+		sl:  sl,
+
+		matcher: matcher,
+		config:  config,
 	}
 
-	http.HandleFunc("/", http.NotFound)           // will this handle anything that's not defined?
-	http.HandleFunc("/webhooks", pl.handle)       // from zulip
-	http.HandleFunc("/match", pl.match)           // from GCP
-	http.HandleFunc("/endofbatch", pl.endofbatch) // manually triggered
+	http.HandleFunc("/", http.NotFound)             // will this handle anything that's not defined?
+	http.HandleFunc("/webhooks", pl.handle)         // from zulip
+	http.HandleFunc("/match", pl.match)             // from GCP
+	http.HandleFunc("/match/preview", pl.preview)   // manually triggered by organizers
+	http.HandleFunc("/feedback", pl.askForFeedback) // from GCP
+	http.HandleFunc("/endofbatch", pl.endofbatch)   // manually triggered
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -68,6 +129,45 @@ func main() {
 		}
 	}
 
+	if w, ok := os.LookupEnv("PB_REPEAT_WINDOW_DAYS"); ok {
+		days, err := strconv.Atoi(w)
+		if err != nil || days < 0 {
+			log.Printf("Ignoring bad PB_REPEAT_WINDOW_DAYS %q", w)
+		} else {
+			repeatWindowDays = days
+		}
+	}
+
+	if n, ok := os.LookupEnv("PB_NOSHOW_LIMIT"); ok {
+		limit, err := strconv.Atoi(n)
+		if err != nil || limit < 1 {
+			log.Printf("Ignoring bad PB_NOSHOW_LIMIT %q", n)
+		} else {
+			noShowLimit = limit
+		}
+	}
+
+	if w, ok := os.LookupEnv("PB_PAIR_NOW_MINUTES"); ok {
+		minutes, err := strconv.Atoi(w)
+		if err != nil || minutes < 1 {
+			log.Printf("Ignoring bad PB_PAIR_NOW_MINUTES %q", w)
+		} else {
+			pairNowWindow = time.Duration(minutes) * time.Minute
+		}
+	}
+
+	// -replay 2006-01-02 re-runs that day's matching offline, prints the groups and quits
+	if *replayDate != "" {
+		preview, err := pl.replay(ctx, *replayDate)
+		if err != nil {
+			log.Panic(err)
+		}
+		if err = json.NewEncoder(os.Stdout).Encode(preview); err != nil {
+			log.Panic(err)
+		}
+		return
+	}
+
 	log.Printf("Listening on port %s", port)
 	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", port), nil))
 }
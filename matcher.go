@@ -0,0 +1,650 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// a group is a set of recursers who were matched together in a stream
+type group struct {
+	stream  string
+	members []Recurser
+}
+
+// a Matcher decides who gets paired with whom on a given day.
+// Matchers never talk to the database or to zulip, so they're easy to test
+type Matcher interface {
+	Match(input matchInput) matchResult
+}
+
+// matchInput is everything a Matcher gets to look at
+type matchInput struct {
+	// everyone who's eligible to pair today
+	recursers []Recurser
+	// who was matched with whom over the last repeatWindowDays
+	history pairHistory
+	// how many times each recurser didn't show up over the same days
+	noShows map[string]int
+	date    time.Time
+	rnd     *rand.Rand
+}
+
+// matchResult is everything a matching run decided
+type matchResult struct {
+	groups []group
+	// everyone who asked to pair but didn't get a single partner
+	leftOut []Recurser
+}
+
+// pairHistory remembers the last date (YYYY-MM-DD) two recursers were matched
+type pairHistory map[[2]string]string
+
+func newPairHistory(records []matchRecord) pairHistory {
+	history := make(pairHistory)
+	for _, record := range records {
+		// people who declined didn't meet
+		members := record.active()
+		for i, one := range members {
+			for _, two := range members[i+1:] {
+				key := idPairKey(one, two)
+				if record.date > history[key] {
+					history[key] = record.date
+				}
+			}
+		}
+	}
+	return history
+}
+
+// people who didn't show up this many times in the history are matched last
+const chronicNoShows = 2
+
+// countNoShows counts, for each recurser, the matches where a partner said
+// they didn't pair and the recurser didn't say they did. Nobody can tell from
+// the feedback alone who didn't turn up, so if nobody says yes, everyone
+// who didn't answer counts. If everyone says no, they probably agreed not to,
+// so nobody counts. Declining ahead of time isn't a no-show
+func countNoShows(records []matchRecord) map[string]int {
+	noShows := make(map[string]int)
+	for _, record := range records {
+		members := record.active()
+		allNo := true
+		for _, member := range members {
+			if record.feedback[member] != "no" {
+				allNo = false
+			}
+		}
+		if allNo {
+			continue
+		}
+		for _, member := range members {
+			if answer := record.feedback[member]; answer != "" && answer != "no" {
+				continue
+			}
+			for _, other := range members {
+				if other != member && record.feedback[other] == "no" {
+					noShows[member]++
+					break
+				}
+			}
+		}
+	}
+	return noShows
+}
+
+// lastMet is "" if the two have never been matched
+func (h pairHistory) lastMet(one, two string) string {
+	return h[idPairKey(one, two)]
+}
+
+func idPairKey(one, two string) [2]string {
+	if one > two {
+		one, two = two, one
+	}
+	return [2]string{one, two}
+}
+
+// streamSet is a set of stream names, where "*" stands for every stream
+type streamSet map[string]bool
+
+func newStreamSet(list string) streamSet {
+	set := make(streamSet)
+	for _, stream := range strings.Split(list, ",") {
+		stream = strings.ToLower(strings.TrimSpace(stream))
+		if stream != "" {
+			set[stream] = true
+		}
+	}
+	return set
+}
+
+func (s streamSet) has(stream string) bool {
+	return s["*"] || s[stream]
+}
+
+// matcherConfig is the configuration every Matcher shares
+type matcherConfig struct {
+	// the streams where an odd one out joins a pair instead of being left out
+	trioStreams streamSet
+	// how long people's `hours` have to overlap for them to be matched
+	minOverlap time.Duration
+}
+
+// randomMatcher pairs people at random, ignoring who they've met before
+type randomMatcher struct {
+	matcherConfig
+}
+
+func (m *randomMatcher) Match(input matchInput) matchResult {
+	return matchRecursers(input.recursers, matchOptions{
+		matcherConfig: m.matcherConfig,
+		date:          input.date,
+	}, input.rnd)
+}
+
+// historyMatcher avoids pairing people who were matched recently
+type historyMatcher struct {
+	matcherConfig
+}
+
+func (m *historyMatcher) Match(input matchInput) matchResult {
+	return matchRecursers(input.recursers, matchOptions{
+		matcherConfig: m.matcherConfig,
+		date:          input.date,
+		history:       input.history,
+		noShows:       input.noShows,
+	}, input.rnd)
+}
+
+// streamPriorityMatcher is a historyMatcher that matches streams in the
+// order people listed them in with `streams`
+type streamPriorityMatcher struct {
+	matcherConfig
+}
+
+func (m *streamPriorityMatcher) Match(input matchInput) matchResult {
+	return matchRecursers(input.recursers, matchOptions{
+		matcherConfig: m.matcherConfig,
+		date:          input.date,
+		history:       input.history,
+		noShows:       input.noShows,
+		userPriority:  true,
+	}, input.rnd)
+}
+
+// newMatcher makes the Matcher with the given name (see PB_MATCHER in main)
+func newMatcher(name string, config matcherConfig) (Matcher, error) {
+	switch name {
+	case "random":
+		return &randomMatcher{config}, nil
+	case "history":
+		return &historyMatcher{config}, nil
+	case "priority":
+		return &streamPriorityMatcher{config}, nil
+	}
+	return nil, fmt.Errorf("unknown matcher %q", name)
+}
+
+// matchOptions are the knobs the different Matchers turn on matchRecursers
+type matchOptions struct {
+	matcherConfig
+	// when the matching is happening
+	date    time.Time
+	history pairHistory
+	noShows map[string]int
+	// match streams in the order people listed them, instead of
+	// just the narrowest ones first
+	userPriority bool
+}
+
+// canGroup says whether the members may be matched together at all: nobody
+// has blocked anybody, and their `hours` overlap for long enough
+func (opts matchOptions) canGroup(members ...Recurser) bool {
+	for i, one := range members {
+		for _, two := range members[i+1:] {
+			if !canPair(one, two) {
+				return false
+			}
+		}
+	}
+	start, end := sharedWindow(members, opts.date)
+	overlap := end.Sub(start)
+	return overlap > 0 && overlap >= opts.minOverlap
+}
+
+// unreliable is true for people who keep not showing up to their pairings
+func (opts matchOptions) unreliable(r Recurser) bool {
+	return opts.noShows[r.id] >= chronicNoShows
+}
+
+// matchRecursers pairs up recursers within each of their streams. The number a
+// recurser gave for a stream is treated as how many partners they'd like in
+// that stream per day, so `any 2` gets (up to) two different partners.
+// The same two people are never grouped together twice in a day, even if they
+// share several streams, and the recursers' own streams maps are never modified.
+// Pairs in the history are only made when there's nobody else left, and then
+// whoever met longest ago is preferred.
+// In the trioStreams, anyone who couldn't be paired joins one of the pairs
+// to make a group of three.
+// People are only matched with others whose local day (see localPairingDay)
+// is the same as theirs.
+func matchRecursers(recursers []Recurser, opts matchOptions, rnd *rand.Rand) matchResult {
+	byDay := make(map[string][]Recurser)
+	var days []string
+	for _, r := range recursers {
+		day := r.localPairingDay(opts.date).Format(dateLayout)
+		if _, ok := byDay[day]; !ok {
+			days = append(days, day)
+		}
+		byDay[day] = append(byDay[day], r)
+	}
+	sort.Strings(days)
+
+	var result matchResult
+	for _, day := range days {
+		dayResult := matchDay(byDay[day], opts, rnd)
+		result.groups = append(result.groups, dayResult.groups...)
+		result.leftOut = append(result.leftOut, dayResult.leftOut...)
+	}
+	return result
+}
+
+// matchDay does the matching for people who all share the same local day
+func matchDay(recursers []Recurser, opts matchOptions, rnd *rand.Rand) matchResult {
+	var result matchResult
+
+	// make map of stream to the recursers that selected this stream
+	recursersIndListPerStream := make(map[string][]int)
+	for i, recurser := range recursers {
+		for stream, count := range recurser.streams {
+			if count > 0 {
+				recursersIndListPerStream[stream] = append(recursersIndListPerStream[stream], i)
+			}
+		}
+	}
+
+	streams := orderStreams(recursers, recursersIndListPerStream, opts.userPriority)
+
+	// everyone who's been grouped with each other today, across all streams,
+	// so nobody gets the same partner twice in one day
+	paired := make(map[[2]int]bool)
+
+	matchCount := make([]int, len(recursers))
+	for _, stream := range streams {
+		inds := recursersIndListPerStream[stream]
+
+		var streamGroups [][]int
+		inGroup := make(map[int]bool)
+		for _, pair := range pairStream(recursers, inds, stream, opts, paired, rnd) {
+			streamGroups = append(streamGroups, []int{pair[0], pair[1]})
+			inGroup[pair[0]] = true
+			inGroup[pair[1]] = true
+		}
+
+		if opts.trioStreams.has(stream) {
+			for _, i := range inds {
+				if inGroup[i] {
+					continue
+				}
+				if g := pickTrio(recursers, streamGroups, i, opts, paired, rnd); g != -1 {
+					for _, j := range streamGroups[g] {
+						paired[pairKey(i, j)] = true
+					}
+					streamGroups[g] = append(streamGroups[g], i)
+					inGroup[i] = true
+				}
+			}
+		}
+
+		for _, members := range streamGroups {
+			g := group{stream: stream}
+			for _, i := range members {
+				matchCount[i]++
+				g.members = append(g.members, recursers[i])
+			}
+			result.groups = append(result.groups, g)
+		}
+	}
+
+	for i, recurser := range recursers {
+		if matchCount[i] == 0 && len(recursersStreams(recurser)) > 0 {
+			result.leftOut = append(result.leftOut, recurser)
+		}
+	}
+	return result
+}
+
+// orderStreams decides which streams get matched first. Since nobody is
+// matched with the same person twice in a day, earlier streams use people up:
+// narrower streams go first so that `any` doesn't take someone who was the
+// only other person interested in `math`.
+// With userPriority, streams that people listed earlier in their `streams`
+// command (on average) go first, and narrowness only breaks ties.
+func orderStreams(recursers []Recurser, recursersIndListPerStream map[string][]int, userPriority bool) []string {
+	// start from a fixed order so a given random source always gives the same matches
+	var streams []string
+	for stream := range recursersIndListPerStream {
+		streams = append(streams, stream)
+	}
+	sort.Strings(streams)
+	sort.SliceStable(streams, func(i, j int) bool {
+		return len(recursersIndListPerStream[streams[i]]) < len(recursersIndListPerStream[streams[j]])
+	})
+	if !userPriority {
+		return streams
+	}
+
+	// the average position of each stream in people's lists; streams
+	// nobody ranked go after the ones somebody did
+	rank := make(map[string]float64)
+	for _, stream := range streams {
+		var total, count float64
+		for _, i := range recursersIndListPerStream[stream] {
+			for pos, s := range recursers[i].streamOrder {
+				if s == stream {
+					total += float64(pos)
+					count++
+					break
+				}
+			}
+		}
+		if count == 0 {
+			rank[stream] = math.MaxFloat64
+		} else {
+			rank[stream] = total / count
+		}
+	}
+	sort.SliceStable(streams, func(i, j int) bool {
+		return rank[streams[i]] < rank[streams[j]]
+	})
+	return streams
+}
+
+// pairStream makes as many pairs as it can out of the recursers at inds,
+// respecting how many partners each of them wants in this stream.
+// People who prefer each other are paired first. After that it always pairs
+// up whoever still needs the most partners first; this is what keeps one
+// person with a big count from being stranded at the end.
+// Anyone already in paired can't be paired again, and the new pairs are added to it.
+func pairStream(recursers []Recurser, inds []int, stream string, opts matchOptions, paired map[[2]int]bool, rnd *rand.Rand) [][2]int {
+	// shuffle first so ties are broken randomly
+	shuffled := make([]int, len(inds))
+	copy(shuffled, inds)
+	rnd.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	// then whoever was left out most recently goes first, so the person
+	// left over at the end is whoever was left out least recently.
+	// people who keep not showing up go after everyone else, though
+	sort.SliceStable(shuffled, func(i, j int) bool {
+		one, two := recursers[shuffled[i]], recursers[shuffled[j]]
+		if opts.unreliable(one) != opts.unreliable(two) {
+			return opts.unreliable(two)
+		}
+		return leftOutBefore(one, two)
+	})
+
+	remaining := make(map[int]int)
+	for _, i := range shuffled {
+		remaining[i] = recursers[i].streams[stream]
+	}
+
+	var pairs [][2]int
+	pair := func(one, two int) {
+		remaining[one]--
+		remaining[two]--
+		paired[pairKey(one, two)] = true
+		pairs = append(pairs, [2]int{one, two})
+	}
+
+	// people who both asked to be matched with each other go first
+	for x, one := range shuffled {
+		for _, two := range shuffled[x+1:] {
+			if remaining[one] > 0 && remaining[two] > 0 && !paired[pairKey(one, two)] &&
+				opts.canGroup(recursers[one], recursers[two]) && mutuallyPreferred(recursers[one], recursers[two]) {
+				pair(one, two)
+			}
+		}
+	}
+
+	for {
+		one := -1
+		for _, i := range shuffled {
+			if remaining[i] > 0 && (one == -1 || remaining[i] > remaining[one]) {
+				one = i
+			}
+		}
+		if one == -1 {
+			break
+		}
+
+		two := -1
+		var twoChoice partnerChoice
+		for _, j := range shuffled {
+			if j == one || remaining[j] == 0 || paired[pairKey(one, j)] || !opts.canGroup(recursers[one], recursers[j]) {
+				continue
+			}
+			choice := partnerChoice{
+				lastMet:    opts.history.lastMet(recursers[one].id, recursers[j].id),
+				unreliable: opts.unreliable(recursers[j]),
+				fit:        partnerFit(recursers[one], recursers[j]),
+				remaining:  remaining[j],
+			}
+			if two == -1 || choice.better(twoChoice) {
+				two = j
+				twoChoice = choice
+			}
+		}
+		// nobody is left for them in this stream
+		if two == -1 {
+			remaining[one] = 0
+			continue
+		}
+
+		pair(one, two)
+	}
+	return pairs
+}
+
+// canPair is for the hard rules about who may never be matched together,
+// whatever else is going on
+func canPair(one, two Recurser) bool {
+	// blocks work both ways
+	if _, ok := one.blocked[two.id]; ok {
+		return false
+	}
+	if _, ok := two.blocked[one.id]; ok {
+		return false
+	}
+	return true
+}
+
+// a partnerChoice is what's known about how good a partner someone would be
+type partnerChoice struct {
+	lastMet    string
+	unreliable bool
+	fit        int
+	remaining  int
+}
+
+// better says whether c is a better partner than other. People who haven't
+// met recently come first, then people who show up to their pairings, then
+// whoever fits best, then whoever met longest ago, and then whoever still
+// needs the most partners
+func (c partnerChoice) better(other partnerChoice) bool {
+	if (c.lastMet == "") != (other.lastMet == "") {
+		return c.lastMet == ""
+	}
+	if c.unreliable != other.unreliable {
+		return other.unreliable
+	}
+	if c.fit != other.fit {
+		return c.fit > other.fit
+	}
+	if c.lastMet != other.lastMet {
+		return c.lastMet < other.lastMet
+	}
+	return c.remaining > other.remaining
+}
+
+// the experience levels people can pick with `level`, from least to most experienced
+var experienceLevels = []string{"beginner", "intermediate", "experienced"}
+
+func levelIndex(level string) int {
+	for i, l := range experienceLevels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// partnerFit scores how well two people suit each other, going by what they
+// told us with `level`, `role`, `levels` and `languages`. Higher is better,
+// and 0 means there's nothing to go on
+func partnerFit(one, two Recurser) int {
+	return levelFit(one, two) + levelFit(two, one) + 2*len(commonLanguages([]Recurser{one, two}))
+}
+
+// commonLanguages are the languages everyone in recursers picked
+func commonLanguages(recursers []Recurser) []string {
+	if len(recursers) == 0 {
+		return nil
+	}
+	var common []string
+	for _, language := range recursers[0].languages {
+		inAll := true
+		for _, r := range recursers[1:] {
+			if !contains(r.languages, language) {
+				inAll = false
+				break
+			}
+		}
+		if inAll && !contains(common, language) {
+			common = append(common, language)
+		}
+	}
+	return common
+}
+
+// levelFit is how happy one would be with two as a partner
+func levelFit(one, two Recurser) int {
+	fit := 0
+	oneLevel, twoLevel := levelIndex(one.level), levelIndex(two.level)
+
+	// mentors want mentees and mentees want mentors, as long as
+	// the levels (if we know them) go the right way
+	switch {
+	case one.role == "mentor" && two.role == "mentee" && (oneLevel == -1 || twoLevel == -1 || oneLevel > twoLevel):
+		fit += 3
+	case one.role == "mentee" && two.role == "mentor" && (oneLevel == -1 || twoLevel == -1 || oneLevel < twoLevel):
+		fit += 3
+	}
+
+	if oneLevel == -1 || twoLevel == -1 {
+		return fit
+	}
+	diff := oneLevel - twoLevel
+	if diff < 0 {
+		diff = -diff
+	}
+	switch one.levelMatch {
+	case "similar":
+		fit += 2 - 2*diff
+	case "across":
+		if diff == 0 {
+			fit -= 2
+		} else {
+			fit += 2
+		}
+	}
+	return fit
+}
+
+// mutuallyPreferred is true if both of them used `prefer` on each other
+func mutuallyPreferred(one, two Recurser) bool {
+	_, oneWants := one.preferred[two.id]
+	_, twoWants := two.preferred[one.id]
+	return oneWants && twoWants
+}
+
+// leftOutBefore says whether one should get priority over two because
+// they were left out more recently (or more often, if it was the same day)
+func leftOutBefore(one, two Recurser) bool {
+	if one.lastLeftOut != two.lastLeftOut {
+		return one.lastLeftOut > two.lastLeftOut
+	}
+	return one.timesLeftOut > two.timesLeftOut
+}
+
+// pickTrio finds the pair that recurser i should join, preferring pairs
+// they haven't met recently. It's -1 if there's no pair left to join
+func pickTrio(recursers []Recurser, groups [][]int, i int, opts matchOptions, paired map[[2]int]bool, rnd *rand.Rand) int {
+	best := -1
+	var bestLastMet string
+	for _, g := range rnd.Perm(len(groups)) {
+		if len(groups[g]) != 2 || paired[pairKey(i, groups[g][0])] || paired[pairKey(i, groups[g][1])] {
+			continue
+		}
+		if !opts.canGroup(recursers[i], recursers[groups[g][0]], recursers[groups[g][1]]) {
+			continue
+		}
+		var lastMet string
+		for _, j := range groups[g] {
+			if met := opts.history.lastMet(recursers[i].id, recursers[j].id); met > lastMet {
+				lastMet = met
+			}
+		}
+		if best == -1 || lastMet < bestLastMet {
+			best = g
+			bestLastMet = lastMet
+		}
+	}
+	return best
+}
+
+func pairKey(i, j int) [2]int {
+	if i > j {
+		i, j = j, i
+	}
+	return [2]int{i, j}
+}
+
+// sharedStreams lists the streams everyone in the group picked, starting
+// with the one they were matched on
+func (g group) sharedStreams() []string {
+	shared := []string{g.stream}
+	if len(g.members) == 0 {
+		return shared
+	}
+	for _, stream := range recursersStreams(g.members[0]) {
+		if stream == g.stream {
+			continue
+		}
+		inAll := true
+		for _, member := range g.members[1:] {
+			if member.streams[stream] <= 0 {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			shared = append(shared, stream)
+		}
+	}
+	return shared
+}
+
+// recursersStreams returns the streams a recurser actually wants pairings in
+func recursersStreams(r Recurser) []string {
+	var streams []string
+	for stream, count := range r.streams {
+		if count > 0 {
+			streams = append(streams, stream)
+		}
+	}
+	sort.Strings(streams)
+	return streams
+}
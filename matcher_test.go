@@ -0,0 +1,425 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func newTestRecurser(id string, streams map[string]int) Recurser {
+	return Recurser{
+		id:      id,
+		name:    "recurser " + id,
+		email:   id + "@example.com",
+		streams: streams,
+	}
+}
+
+var tableMatchRecursers = []struct {
+	testName      string
+	recursers     []Recurser
+	wantedGroups  int
+	wantedLeftOut int
+}{
+	{"nobody", nil, 0, 0},
+	{"one_person", []Recurser{
+		newTestRecurser("1", map[string]int{"any": 1}),
+	}, 0, 1},
+	{"two_people", []Recurser{
+		newTestRecurser("1", map[string]int{"any": 1}),
+		newTestRecurser("2", map[string]int{"any": 1}),
+	}, 1, 0},
+	{"odd_one_out", []Recurser{
+		newTestRecurser("1", map[string]int{"any": 1}),
+		newTestRecurser("2", map[string]int{"any": 1}),
+		newTestRecurser("3", map[string]int{"any": 1}),
+	}, 1, 1},
+	{"two_partners", []Recurser{
+		newTestRecurser("1", map[string]int{"any": 2}),
+		newTestRecurser("2", map[string]int{"any": 1}),
+		newTestRecurser("3", map[string]int{"any": 1}),
+	}, 2, 0},
+	{"no_repeat_pairs", []Recurser{
+		newTestRecurser("1", map[string]int{"any": 3}),
+		newTestRecurser("2", map[string]int{"any": 3}),
+	}, 1, 0},
+	{"separate_streams", []Recurser{
+		newTestRecurser("1", map[string]int{"rust": 1}),
+		newTestRecurser("2", map[string]int{"math": 1}),
+	}, 0, 2},
+	{"zero_count", []Recurser{
+		newTestRecurser("1", map[string]int{"any": 0}),
+		newTestRecurser("2", map[string]int{"any": 1}),
+	}, 0, 1},
+}
+
+func TestMatchRecursers(t *testing.T) {
+	for _, tt := range tableMatchRecursers {
+		t.Run(tt.testName, func(t *testing.T) {
+			result := matchRecursers(tt.recursers, matchOptions{}, rand.New(rand.NewSource(1)))
+			if len(result.groups) != tt.wantedGroups || len(result.leftOut) != tt.wantedLeftOut {
+				t.Errorf("got %v groups and %v left out, wanted %v and %v\n", len(result.groups), len(result.leftOut), tt.wantedGroups, tt.wantedLeftOut)
+			}
+
+			seen := make(map[string]bool)
+			for _, g := range result.groups {
+				if len(g.members) != 2 {
+					t.Errorf("got a group of %v in stream %v\n", len(g.members), g.stream)
+					continue
+				}
+				key := g.stream + ":" + g.members[0].id + "," + g.members[1].id
+				if g.members[0].id > g.members[1].id {
+					key = g.stream + ":" + g.members[1].id + "," + g.members[0].id
+				}
+				if seen[key] {
+					t.Errorf("%v and %v were matched twice in stream %v\n", g.members[0].id, g.members[1].id, g.stream)
+				}
+				seen[key] = true
+			}
+		})
+	}
+}
+
+func TestMatchRecursersRespectsCapacity(t *testing.T) {
+	var recursers []Recurser
+	wanted := make(map[string]int)
+	for i := 0; i < 10; i++ {
+		id := fmt.Sprint(i)
+		wanted[id] = 1 + i%3
+		recursers = append(recursers, newTestRecurser(id, map[string]int{"any": wanted[id]}))
+	}
+
+	for seed := int64(0); seed < 20; seed++ {
+		result := matchRecursers(recursers, matchOptions{}, rand.New(rand.NewSource(seed)))
+		counts := make(map[string]int)
+		for _, g := range result.groups {
+			for _, member := range g.members {
+				counts[member.id]++
+			}
+		}
+		for _, r := range recursers {
+			if counts[r.id] > r.streams["any"] {
+				t.Errorf("seed %v: %v asked for %v partners but got %v\n", seed, r.id, r.streams["any"], counts[r.id])
+			}
+			if r.streams["any"] != wanted[r.id] {
+				t.Errorf("seed %v: the streams of %v were modified\n", seed, r.id)
+			}
+		}
+	}
+}
+
+func TestMatchRecursersAvoidsRecentPartners(t *testing.T) {
+	recursers := []Recurser{
+		newTestRecurser("1", map[string]int{"any": 1}),
+		newTestRecurser("2", map[string]int{"any": 1}),
+		newTestRecurser("3", map[string]int{"any": 1}),
+		newTestRecurser("4", map[string]int{"any": 1}),
+	}
+	history := newPairHistory([]matchRecord{
+		{date: "2026-10-12", stream: "any", members: []string{"1", "2"}},
+		{date: "2026-10-13", stream: "any", members: []string{"3", "4"}},
+	})
+
+	for seed := int64(0); seed < 20; seed++ {
+		result := matchRecursers(recursers, matchOptions{history: history}, rand.New(rand.NewSource(seed)))
+		for _, g := range result.groups {
+			if history.lastMet(g.members[0].id, g.members[1].id) != "" {
+				t.Errorf("seed %v: %v and %v were matched again\n", seed, g.members[0].id, g.members[1].id)
+			}
+		}
+	}
+}
+
+func TestMatchRecursersTrios(t *testing.T) {
+	recursers := []Recurser{
+		newTestRecurser("1", map[string]int{"any": 1}),
+		newTestRecurser("2", map[string]int{"any": 1}),
+		newTestRecurser("3", map[string]int{"any": 1}),
+		newTestRecurser("4", map[string]int{"rust": 1}),
+		newTestRecurser("5", map[string]int{"rust": 1}),
+		newTestRecurser("6", map[string]int{"rust": 1}),
+	}
+
+	result := matchRecursers(recursers, matchOptions{matcherConfig: matcherConfig{trioStreams: newStreamSet("any")}}, rand.New(rand.NewSource(1)))
+	if len(result.groups) != 2 || len(result.leftOut) != 1 {
+		t.Fatalf("got %v groups and %v left out, wanted 2 and 1\n", len(result.groups), len(result.leftOut))
+	}
+	for _, g := range result.groups {
+		if g.stream == "any" && len(g.members) != 3 {
+			t.Errorf("wanted a trio in stream any, got %v people\n", len(g.members))
+		}
+		if g.stream == "rust" && len(g.members) != 2 {
+			t.Errorf("wanted a pair in stream rust, got %v people\n", len(g.members))
+		}
+	}
+}
+
+func TestMatchRecursersLeavesOutFairly(t *testing.T) {
+	recursers := []Recurser{
+		newTestRecurser("1", map[string]int{"any": 1}),
+		newTestRecurser("2", map[string]int{"any": 1}),
+		newTestRecurser("3", map[string]int{"any": 1}),
+	}
+	recursers[0].lastLeftOut = "2026-10-13"
+	recursers[0].timesLeftOut = 1
+	recursers[1].lastLeftOut = "2026-10-01"
+	recursers[1].timesLeftOut = 2
+
+	for seed := int64(0); seed < 20; seed++ {
+		result := matchRecursers(recursers, matchOptions{}, rand.New(rand.NewSource(seed)))
+		if len(result.leftOut) != 1 || result.leftOut[0].id != "3" {
+			t.Errorf("seed %v: wanted 3 to be left out, got %v\n", seed, result.leftOut)
+		}
+	}
+}
+
+func TestNewMatcher(t *testing.T) {
+	for _, name := range []string{"random", "history", "priority"} {
+		m, err := newMatcher(name, matcherConfig{})
+		if err != nil {
+			t.Errorf("couldn't make matcher %v: %v\n", name, err)
+			continue
+		}
+		result := m.Match(matchInput{
+			recursers: []Recurser{
+				newTestRecurser("1", map[string]int{"any": 1}),
+				newTestRecurser("2", map[string]int{"any": 1}),
+			},
+			rnd: rand.New(rand.NewSource(1)),
+		})
+		if len(result.groups) != 1 {
+			t.Errorf("matcher %v made %v groups, wanted 1\n", name, len(result.groups))
+		}
+	}
+	if _, err := newMatcher("mooh", matcherConfig{}); err == nil {
+		t.Errorf("expected an error for an unknown matcher\n")
+	}
+}
+
+func TestMatchIsReproducible(t *testing.T) {
+	var recursers []Recurser
+	for i := 0; i < 9; i++ {
+		recursers = append(recursers, newTestRecurser(fmt.Sprint(i), map[string]int{"any": 1 + i%2, "rust": i % 3}))
+	}
+	m := &historyMatcher{matcherConfig{trioStreams: newStreamSet("rust")}}
+
+	run := func() string {
+		result := m.Match(matchInput{recursers: recursers, rnd: rand.New(rand.NewSource(42))})
+		var out string
+		for _, g := range result.groups {
+			out += g.stream
+			for _, member := range g.members {
+				out += " " + member.id
+			}
+			out += "\n"
+		}
+		return out
+	}
+
+	first := run()
+	for i := 0; i < 5; i++ {
+		if again := run(); again != first {
+			t.Errorf("the same seed gave different matches:\n%v\nand\n%v\n", first, again)
+		}
+	}
+}
+
+func TestMatchRecursersAcrossStreams(t *testing.T) {
+	recursers := []Recurser{
+		newTestRecurser("1", map[string]int{"any": 1, "rust": 1}),
+		newTestRecurser("2", map[string]int{"any": 1, "rust": 1}),
+	}
+
+	result := matchRecursers(recursers, matchOptions{}, rand.New(rand.NewSource(1)))
+	if len(result.groups) != 1 {
+		t.Fatalf("got %v groups, wanted the pair to be matched once\n", len(result.groups))
+	}
+	shared := result.groups[0].sharedStreams()
+	if len(shared) != 2 || shared[0] != result.groups[0].stream {
+		t.Errorf("got shared streams %v for a match on %v\n", shared, result.groups[0].stream)
+	}
+}
+
+func TestOrderStreams(t *testing.T) {
+	recursers := []Recurser{
+		newTestRecurser("1", map[string]int{"any": 1, "math": 1}),
+		newTestRecurser("2", map[string]int{"any": 1, "math": 1}),
+		newTestRecurser("3", map[string]int{"any": 1}),
+	}
+	recursers[0].streamOrder = []string{"any", "math"}
+	recursers[1].streamOrder = []string{"any", "math"}
+	perStream := map[string][]int{"any": {0, 1, 2}, "math": {0, 1}}
+
+	if got := orderStreams(recursers, perStream, false); got[0] != "math" {
+		t.Errorf("wanted the narrowest stream first, got %v\n", got)
+	}
+	if got := orderStreams(recursers, perStream, true); got[0] != "any" {
+		t.Errorf("wanted the stream people listed first, got %v\n", got)
+	}
+}
+
+func TestMatchRecursersRespectsBlocks(t *testing.T) {
+	recursers := []Recurser{
+		newTestRecurser("1", map[string]int{"any": 1}),
+		newTestRecurser("2", map[string]int{"any": 1}),
+		newTestRecurser("3", map[string]int{"any": 1}),
+	}
+	recursers[0].blocked = map[string]string{"2": "recurser 2"}
+	recursers[2].blocked = map[string]string{"1": "recurser 1"}
+
+	for seed := int64(0); seed < 20; seed++ {
+		result := matchRecursers(recursers, matchOptions{matcherConfig: matcherConfig{trioStreams: newStreamSet("*")}}, rand.New(rand.NewSource(seed)))
+		if len(result.groups) != 1 || len(result.groups[0].members) != 2 {
+			t.Fatalf("seed %v: wanted only 2 and 3 to be matched, got %v\n", seed, result.groups)
+		}
+		for _, member := range result.groups[0].members {
+			if member.id == "1" {
+				t.Errorf("seed %v: 1 was matched with someone they blocked or who blocked them\n", seed)
+			}
+		}
+	}
+}
+
+func TestMatchRecursersHonorsMutualPreferences(t *testing.T) {
+	recursers := []Recurser{
+		newTestRecurser("1", map[string]int{"any": 1}),
+		newTestRecurser("2", map[string]int{"any": 1}),
+		newTestRecurser("3", map[string]int{"any": 1}),
+		newTestRecurser("4", map[string]int{"any": 1}),
+	}
+	recursers[0].preferred = map[string]string{"4": "recurser 4"}
+	recursers[3].preferred = map[string]string{"1": "recurser 1"}
+	// one-sided, so it shouldn't matter
+	recursers[1].preferred = map[string]string{"3": "recurser 3"}
+
+	for seed := int64(0); seed < 20; seed++ {
+		result := matchRecursers(recursers, matchOptions{}, rand.New(rand.NewSource(seed)))
+		found := false
+		for _, g := range result.groups {
+			if idPairKey(g.members[0].id, g.members[1].id) == idPairKey("1", "4") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("seed %v: 1 and 4 prefer each other but weren't matched\n", seed)
+		}
+	}
+}
+
+func TestPartnerFit(t *testing.T) {
+	beginner := Recurser{id: "1", level: "beginner", levelMatch: "similar"}
+	alsoBeginner := Recurser{id: "2", level: "beginner"}
+	experienced := Recurser{id: "3", level: "experienced"}
+	if partnerFit(beginner, alsoBeginner) <= partnerFit(beginner, experienced) {
+		t.Errorf("a beginner who wants similar levels should fit another beginner best\n")
+	}
+
+	beginner.levelMatch = "across"
+	if partnerFit(beginner, experienced) <= partnerFit(beginner, alsoBeginner) {
+		t.Errorf("a beginner who wants other levels should fit an experienced person best\n")
+	}
+
+	mentor := Recurser{id: "4", level: "experienced", role: "mentor"}
+	mentee := Recurser{id: "5", level: "beginner", role: "mentee"}
+	if partnerFit(mentor, mentee) <= partnerFit(mentor, experienced) {
+		t.Errorf("a mentor should fit a mentee best\n")
+	}
+	if partnerFit(Recurser{}, Recurser{}) != 0 {
+		t.Errorf("people who haven't said anything should fit 0\n")
+	}
+}
+
+func TestMatchRecursersPrefersCommonLanguages(t *testing.T) {
+	recursers := []Recurser{
+		newTestRecurser("1", map[string]int{"any": 1}),
+		newTestRecurser("2", map[string]int{"any": 1}),
+		newTestRecurser("3", map[string]int{"any": 1}),
+		newTestRecurser("4", map[string]int{"any": 1}),
+	}
+	recursers[0].languages = []string{"go", "rust"}
+	recursers[1].languages = []string{"python"}
+	recursers[2].languages = []string{"rust"}
+	recursers[3].languages = []string{"python", "c"}
+
+	for seed := int64(0); seed < 20; seed++ {
+		result := matchRecursers(recursers, matchOptions{}, rand.New(rand.NewSource(seed)))
+		for _, g := range result.groups {
+			if len(commonLanguages(g.members)) == 0 {
+				t.Errorf("seed %v: %v and %v have no languages in common\n", seed, g.members[0].id, g.members[1].id)
+			}
+		}
+	}
+}
+
+func TestMatchRecursersOnlyMatchesTheSameLocalDay(t *testing.T) {
+	recursers := []Recurser{
+		newTestRecurser("1", map[string]int{"any": 1}),
+		newTestRecurser("2", map[string]int{"any": 1}),
+	}
+	recursers[0].timezone = "America/New_York"
+	recursers[1].timezone = "Asia/Tokyo"
+
+	run := time.Date(2026, time.October, 14, 4, 0, 0, 0, time.UTC)
+	result := matchRecursers(recursers, matchOptions{date: run}, rand.New(rand.NewSource(1)))
+	if len(result.groups) != 0 || len(result.leftOut) != 2 {
+		t.Errorf("people on different local days were matched: %v\n", result.groups)
+	}
+}
+
+func TestMatchRecursersNeedsOverlappingHours(t *testing.T) {
+	recursers := []Recurser{
+		newTestRecurser("1", map[string]int{"any": 1}),
+		newTestRecurser("2", map[string]int{"any": 1}),
+	}
+	recursers[0].hours = "09:00-10:00"
+	recursers[1].hours = "09:30-17:00"
+
+	run := time.Date(2026, time.October, 14, 4, 0, 0, 0, time.UTC)
+	opts := matchOptions{matcherConfig: matcherConfig{minOverlap: time.Hour}, date: run}
+	if result := matchRecursers(recursers, opts, rand.New(rand.NewSource(1))); len(result.groups) != 0 {
+		t.Errorf("people who overlap for half an hour were matched\n")
+	}
+	opts.minOverlap = 30 * time.Minute
+	if result := matchRecursers(recursers, opts, rand.New(rand.NewSource(1))); len(result.groups) != 1 {
+		t.Errorf("people who overlap for half an hour weren't matched\n")
+	}
+}
+
+func TestCountNoShows(t *testing.T) {
+	records := []matchRecord{
+		// 2 says they didn't pair, and 1 didn't say they did
+		{members: []string{"1", "2"}, feedback: map[string]string{"2": "no"}},
+		// 1 says they didn't pair, but 3 rated it, so it doesn't count against either
+		{members: []string{"1", "3"}, feedback: map[string]string{"1": "no", "3": "4"}},
+		// everyone says no, so they probably agreed to skip it
+		{members: []string{"1", "4"}, feedback: map[string]string{"1": "no", "4": "no"}},
+		// 5 says no and the others didn't answer
+		{members: []string{"4", "5", "6"}, feedback: map[string]string{"5": "no"}},
+		// nobody answered
+		{members: []string{"2", "3"}},
+	}
+	noShows := countNoShows(records)
+	wanted := map[string]int{"1": 1, "4": 1, "6": 1}
+	if len(noShows) != len(wanted) || noShows["1"] != wanted["1"] || noShows["4"] != wanted["4"] || noShows["6"] != wanted["6"] {
+		t.Errorf("got %v, wanted %v\n", noShows, wanted)
+	}
+}
+
+func TestMatchRecursersLeavesOutNoShows(t *testing.T) {
+	recursers := []Recurser{
+		newTestRecurser("1", map[string]int{"any": 1}),
+		newTestRecurser("2", map[string]int{"any": 1}),
+		newTestRecurser("3", map[string]int{"any": 1}),
+	}
+	// 3 would usually go first, but they keep not showing up
+	recursers[2].lastLeftOut = "2026-10-13"
+	opts := matchOptions{noShows: map[string]int{"3": chronicNoShows}}
+
+	for seed := int64(0); seed < 20; seed++ {
+		result := matchRecursers(recursers, opts, rand.New(rand.NewSource(seed)))
+		if len(result.leftOut) != 1 || result.leftOut[0].id != "3" {
+			t.Errorf("seed %v: wanted 3 to be left out, got %v\n", seed, result.leftOut)
+		}
+	}
+}
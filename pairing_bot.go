@@ -1,21 +1,41 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
+	"strings"
 	"time"
 )
 
 const owner string = `@_**Maren Beam (SP2'19)**`
-const oddOneOutMessage string = "OK this is awkward.\nThere were an odd number of people in the match-set today, which means that one person couldn't get paired. Unfortunately, it was you -- I'm really sorry :(\nI promise it's not personal, it was very much random. Hopefully this doesn't happen again too soon. Enjoy your day! <3"
-const matchedMessage = "Hi you two! You've been matched for pairing :)\n\nHave fun!"
+const oddOneOutMessage string = "OK this is awkward.\nI couldn't find a pairing partner for you today. Unfortunately, that happens sometimes -- I'm really sorry :(\nI promise it's not personal, and you'll get priority next time. Enjoy your day! <3"
+const matchedMessage = "Hi you two! You've been matched for pairing on %v :)\n\nHave fun!"
+const trioMessage = "Hi you three! There were an odd number of people in the match-set today, so instead of leaving someone out, you've been matched as a group of three on %v :)\n\nHave fun!"
+const feedbackMessage = "Hi! Did you get to pair with %v today? Let me know by sending me `yes`, `no`, or `rate 1` to `rate 5` if you'd like to say how it went :)"
+const suspendedMessage = "Hi! %v of your recent pairing partners have told me you didn't show up, so I've paused your matches for now. No hard feelings, things happen!\n\nWhenever you're ready to pair again, just send me `resume`."
+const welcomeBackMessage = "Welcome back! Your pause is over, so I'll match you for pairing on your usual schedule again :)\n\nSend me `status` to check your settings."
 const offboardedMessage = "Hi! You've been unsubscribed from Pairing Bot.\n\nThis happens at the end of every batch, and everyone is offboarded even if they're still in batch. If you'd like to re-subscribe, just send me a message that says `subscribe`.\n\nBe well! :)"
 
 var maintenanceMode = false
 
+// people who were matched within this many days try not to be matched again
+var repeatWindowDays = 14
+
+// runs are kept for replaying for this many days
+const runRetentionDays = 30
+
+// people are suspended once this many different partners report them with `noshow`
+var noShowLimit = 3
+
+// feedback is about the most recent match, as long as it was this many days ago at most
+const feedbackDays = 2
+
+const dateLayout = "2006-01-02"
+
 // this is the "id" field from zulip, and is a permanent user ID that's not secret
 // Pairing Bot's owner can add their ID here for testing. ctrl+f "ownerID" to see where it's used
 const ownerID = "215391"
@@ -23,11 +43,15 @@ const ownerID = "215391"
 type PairingLogic struct {
 	rdb RecurserDB
 	adb APIAuthDB
+	mdb MatchHistoryDB
 	ur  userRequest
 	un  userNotification
-}
+	sl  streamLister
 
-var randSrc = rand.New(rand.NewSource(time.Now().UnixNano()))
+	matcher Matcher
+	// the same rules the matcher follows, for matches made outside of it
+	config matcherConfig
+}
 
 func (pl *PairingLogic) handle(w http.ResponseWriter, r *http.Request) {
 	var err error
@@ -112,23 +136,61 @@ func (pl *PairingLogic) match(w http.ResponseWriter, r *http.Request) {
 
 	ctx := r.Context()
 
-	recursersList, err := pl.rdb.ListPairingTomorrow(ctx)
-	log.Println(recursersList)
+	// every run gets its own seed, which is saved with the run so that
+	// the matching can be replayed later (see -replay in main)
+	today := time.Now()
+	seed := today.UnixNano()
+	log.Printf("Matching with seed %v\n", seed)
+
+	if err := pl.rdb.ConvertSkippingTomorrow(ctx, today); err != nil {
+		log.Printf("Could not convert isSkippingTomorrow into skips: %s\n", err)
+	}
+
+	// end the pauses that are over before loading anyone, so they're matched today too
+	pausedList, err := pl.rdb.ListPaused(ctx)
 	if err != nil {
-		log.Printf("Could not get list of recursers from DB: %s\n", err)
+		log.Printf("Could not get list of paused recursers from DB: %s\n", err)
+	}
+	var resumed []Recurser
+	for _, recurser := range pausedList {
+		if recurser.isPaused(today) {
+			continue
+		}
+		recurser.paused = false
+		recurser.pausedUntil = ""
+		if err := pl.rdb.Set(ctx, recurser.id, recurser); err != nil {
+			log.Printf("Could not resume recurser %v: %s\n", recurser.id, err)
+			continue
+		}
+		resumed = append(resumed, recurser)
 	}
 
-	skippersList, err := pl.rdb.ListSkippingTomorrow(ctx)
+	input, recentMatches, err := pl.loadMatchInput(ctx, today, seed)
 	if err != nil {
-		log.Printf("Could not get list of skippers from DB: %s\n", err)
+		log.Printf("Could not get list of recursers from DB: %s\n", err)
 	}
 
-	// get everyone who was set to skip today and set them back to isSkippingTomorrow = false
-	for _, skipper := range skippersList {
-		err := pl.rdb.UnsetSkippingTomorrow(ctx, skipper)
-		if err != nil {
-			log.Printf("Could not unset skipping for recurser %v: %s\n", skipper.id, err)
-		}
+	result := pl.matcher.Match(input)
+
+	// the run is saved so it can be replayed, and so `decline` can find
+	// someone else for the partner of whoever declines
+	run := matchRun{
+		date:      today.Format(dateLayout),
+		ranAt:     today,
+		seed:      seed,
+		recursers: input.recursers,
+		history:   recentMatches,
+	}
+	for _, recurser := range result.leftOut {
+		run.leftOut = append(run.leftOut, recurser.id)
+	}
+	if err := pl.mdb.SetRun(ctx, run); err != nil {
+		log.Printf("Could not record the run for %v: %s\n", run.date, err)
+	}
+	// runs have everyone's settings in them, so they aren't kept for long
+	expired := today.AddDate(0, 0, -runRetentionDays).Format(dateLayout)
+	if err := pl.mdb.DeleteRunsBefore(ctx, expired); err != nil {
+		log.Printf("Could not delete the runs from before %v: %s\n", expired, err)
 	}
 
 	// message the peeps!
@@ -137,78 +199,235 @@ func (pl *PairingLogic) match(w http.ResponseWriter, r *http.Request) {
 		log.Println("Something weird happened trying to read the auth token from the database")
 	}
 
-	// make map of stream to the recursers that selected this stream
-	recursersIndListPerStream := make(map[string][]int)
-	for i, recurser := range recursersList {
-		for stream, _ := range recurser.streams{
-			recursersIndListPerStream[stream] = append(recursersIndListPerStream[stream], i)
+	for _, recurser := range resumed {
+		err := pl.un.sendUserMessage(ctx, botPassword, recurser.email, welcomeBackMessage)
+		if err != nil {
+			log.Printf("Error when trying to send welcome back message to %s: %s\n", recurser.email, err)
 		}
 	}
 
-	// for each stream, shuffle recursers and pair
-	for stream, recursersInds := range recursersIndListPerStream {
-		// shuffle our recursers. This will not error if the list is empty
-		randSrc.Shuffle(len(recursersInds), func(i, j int) {recursersInds[i], recursersInds[j] = recursersInds[j], recursersInds[i]})
+	// if for some reason there's no matches today, we're done
+	if len(result.groups) == 0 {
+		log.Println("No one was signed up to pair today -- so there were no matches")
+	}
+
+	// message everyone who couldn't get a single partner today
+	for _, recurser := range result.leftOut {
+		log.Println("Someone was the odd-one-out today")
+
+		// remember this so they get priority next time
+		pl.recordLeftOut(ctx, recurser, today.Format(dateLayout))
 
-		// if for some reason there's no matches today, we're done
-		if len(recursersInds) == 0 {
-			log.Println(fmt.Sprintf("No one was signed up to pair today in stream %v -- so there were no matches", stream))
+		err = pl.un.sendUserMessage(ctx, botPassword, recurser.email, oddOneOutMessage)
+		if err != nil {
+			log.Printf("Error when trying to send oddOneOut message to %s: %s\n", recurser.email, err)
 		}
+	}
 
-		// TODO: better to have "pair" of 3?
-		// if there's an odd number today, message the last person in the list
-		// and tell them they don't get a match today, then knock them off the list
-		if len(recursersInds)%2 != 0 {
-			recurser := recursersList[recursersInds[len(recursersInds)-1]]
-			recursersInds = recursersInds[:len(recursersInds)-1]
-			log.Println("Someone was the odd-one-out today")
-
-			err := pl.un.sendUserMessage(ctx, botPassword, recurser.email, oddOneOutMessage)
-			if err != nil {
-				log.Printf("Error when trying to send oddOneOut message to %s: %s\n", recurser.email, err)
+	for _, g := range result.groups {
+		var emails []string
+		for _, member := range g.members {
+			emails = append(emails, member.email)
+		}
+		// one message per group, mentioning every stream they have in common
+		message := fmt.Sprintf(matchedMessage, formatList(g.sharedStreams()))
+		if len(g.members) == 3 {
+			message = fmt.Sprintf(trioMessage, formatList(g.sharedStreams()))
+		}
+		if languages := commonLanguages(g.members); len(languages) > 0 {
+			message += fmt.Sprintf("\n\nYou can all pair in %v.", formatList(languages))
+		}
+		for _, member := range g.members {
+			if member.hours != "" {
+				message += fmt.Sprintf("\n\nYou're all free %v.", formatWindow(g.members, today))
+				break
 			}
 		}
+		err := pl.un.sendUserMessage(ctx, botPassword, strings.Join(emails, ", "), message)
+		if err != nil {
+			log.Printf("Error when trying to send matchedMessage to %s: %s\n", emails, err)
+		}
+		log.Printf("%s were matched in stream %v\n", strings.Join(emails, " and "), g.stream)
 
-		// pair adjacent recursers in recursersInds
-		for i := 0; i < len(recursersInds); i += 2 {
-			emails := recursersList[recursersInds[i]].email + ", " + recursersList[recursersInds[i+1]].email
-			err := pl.un.sendUserMessage(ctx, botPassword, emails, matchedMessage)
-			if err != nil {
-				log.Printf("Error when trying to send matchedMessage to %s: %s\n", emails, err)
-			}
+		record := matchRecord{
+			date:   today.Format(dateLayout),
+			stream: g.stream,
+			names:  make(map[string]string),
 		}
+		for _, member := range g.members {
+			record.members = append(record.members, member.id)
+			record.names[member.id] = member.name
+		}
+		if err := pl.mdb.Add(ctx, record); err != nil {
+			log.Printf("Could not record match in stream %v: %s\n", g.stream, err)
+		}
+	}
+}
+
+// recordLeftOut remembers that the recurser didn't get a partner on date, so
+// they get priority next time. recurser might only have that day's streams,
+// so this updates what's stored instead of saving it
+func (pl *PairingLogic) recordLeftOut(ctx context.Context, recurser Recurser, date string) {
+	stored, err := pl.rdb.GetByUserID(ctx, recurser.id, recurser.email, recurser.name)
+	if err != nil {
+		log.Printf("Could not get recurser %v from DB: %s\n", recurser.id, err)
+		return
+	}
+	if !stored.isSubscribed {
+		return
+	}
+	stored.timesLeftOut++
+	stored.lastLeftOut = date
+	if err := pl.rdb.Set(ctx, stored.id, stored); err != nil {
+		log.Printf("Could not record that recurser %v was left out: %s\n", stored.id, err)
+	}
+}
+
+// "askforfeedback" asks everyone whose pairing day is ending whether they
+// actually paired. It runs every hour (it's triggered with app engine's cron
+// service), and asks each person in their own evening
+func (pl *PairingLogic) askForFeedback(w http.ResponseWriter, r *http.Request) {
+	// Check that the request is originating from within app engine
+	// https://cloud.google.com/appengine/docs/flexible/go/scheduling-jobs-with-cron-yaml#validating_cron_requests
+	if r.Header.Get("X-Appengine-Cron") != "true" {
+		http.NotFound(w, r)
+		return
+	}
+
+	ctx := r.Context()
+	now := time.Now()
 
-		// FIXME: N^2 algorithm
-		for i := 0; i < len(recursersInds); i += 1 {
-			recurserOne := recursersList[recursersInds[i]]
-			// skip until recurser is avaiable to match
-			if recurserOne.streams[stream] == 0 {
+	// the runs for days that are ending somewhere were yesterday or today
+	recentMatches, err := pl.mdb.ListSince(ctx, now.AddDate(0, 0, -1).Format(dateLayout))
+	if err != nil {
+		log.Printf("Could not get recent matches from DB: %s\n", err)
+	}
+
+	recursersList, err := pl.rdb.GetAllUsers(ctx)
+	if err != nil {
+		log.Printf("Could not get list of recursers from DB: %s\n", err)
+	}
+	recursers := make(map[string]Recurser)
+	for _, recurser := range recursersList {
+		recursers[recurser.id] = recurser
+	}
+
+	// everyone gets one message, however many people they were matched with
+	partners := make(map[string][]string)
+	var members []string
+	for _, record := range recentMatches {
+		// nobody is asked about a match that was declined
+		active := record.active()
+		if len(active) < 2 {
+			continue
+		}
+		for _, member := range active {
+			// they've unsubscribed since, or it isn't their evening
+			recurser, ok := recursers[member]
+			if !ok || !recurser.dueForFeedback(record, now) {
 				continue
 			}
-			for j := i + 1; j < len(recursersList); j += 1{
-				recurserTwo := recursersList[recursersInds[j]]
-				// skip until first available recurser that is availble to match
-				if (recurserTwo.streams[stream] == 0) {
-					continue
-				}
-				// count/decrement number of matches for each
-				// FIXME: check that changing the numbers here DOES NOT change database value
-				recurserOne.streams[stream] -= 1
-				recurserTwo.streams[stream] -= 1
-				// message
-				emails := recursersList[i].email + ", " + recursersList[i+1].email
-				err := pl.un.sendUserMessage(ctx, botPassword, emails, matchedMessage)
-				if err != nil {
-					log.Printf("Error when trying to send matchedMessage to %s: %s\n", emails, err)
-				}
-				log.Println(recursersList[i].email, "was", "matched", "with", recursersList[i+1].email)
-				// exit loop
-				if (recurserOne.streams[stream] == 0) {
-					break
+			if _, ok := partners[member]; !ok {
+				members = append(members, member)
+			}
+			for _, other := range active {
+				if other != member && !contains(partners[member], record.names[other]) {
+					partners[member] = append(partners[member], record.names[other])
 				}
 			}
 		}
 	}
+
+	botPassword, err := pl.adb.GetKey(ctx, "apiauth", "key")
+	if err != nil {
+		log.Println("Something weird happened trying to read the auth token from the database")
+	}
+
+	for _, member := range members {
+		email := recursers[member].email
+		err := pl.un.sendUserMessage(ctx, botPassword, email, fmt.Sprintf(feedbackMessage, joinAnd(partners[member])))
+		if err != nil {
+			log.Printf("Error when trying to send feedback message to %s: %s\n", email, err)
+		}
+	}
+}
+
+// people are asked whether they paired during this hour of the evening of
+// their pairing day, in their own time zone
+const feedbackHour = 20
+
+// dueForFeedback says whether the recurser should be asked about a match
+// from the run on record.date at the given time: whether it's feedbackHour
+// on the local day that run was for. askForFeedback runs every hour, so
+// that only happens once
+func (r *Recurser) dueForFeedback(record matchRecord, now time.Time) bool {
+	run, err := time.Parse(dateLayout, record.date)
+	if err != nil {
+		return false
+	}
+	day := r.localPairingDay(run.Add(matchHourUTC * time.Hour))
+	evening := time.Date(day.Year(), day.Month(), day.Day(), feedbackHour, 0, 0, 0, day.Location())
+	return !now.Before(evening) && now.Before(evening.Add(time.Hour))
+}
+
+// formatList makes a list of streams or languages read nicely, like "`any`, `math` and `rust`"
+func formatList(items []string) string {
+	var quoted []string
+	for _, item := range items {
+		quoted = append(quoted, "`"+item+"`")
+	}
+	return joinAnd(quoted)
+}
+
+// joinAnd joins a list the way it'd be written in a sentence, like "a, b and c"
+func joinAnd(list []string) string {
+	if len(list) <= 1 {
+		return strings.Join(list, "")
+	}
+	return strings.Join(list[:len(list)-1], ", ") + " and " + list[len(list)-1]
+}
+
+// loadMatchInput gets everything the matcher needs for the given day, and the
+// past matches that went into it. It doesn't change anything in the database,
+// so it's safe to use for previews
+func (pl *PairingLogic) loadMatchInput(ctx context.Context, day time.Time, seed int64) (matchInput, []matchRecord, error) {
+	recursersList, err := pl.rdb.ListPairingTomorrow(ctx, day)
+	if err != nil {
+		return matchInput{}, nil, err
+	}
+
+	recentMatches := pl.loadHistory(ctx, day)
+	return newMatchInput(recursersList, recentMatches, day, seed), recentMatches, nil
+}
+
+// newMatchInput is what the matcher needs to match recursers on day, given
+// the matches from the repeatWindowDays before it
+func newMatchInput(recursers []Recurser, recentMatches []matchRecord, day time.Time, seed int64) matchInput {
+	return matchInput{
+		recursers: recursers,
+		history:   newPairHistory(recentMatches),
+		noShows:   countNoShows(recentMatches),
+		date:      day,
+		rnd:       rand.New(rand.NewSource(seed)),
+	}
+}
+
+// loadHistory gets the matches from the repeatWindowDays before day
+func (pl *PairingLogic) loadHistory(ctx context.Context, day time.Time) []matchRecord {
+	since := day.AddDate(0, 0, -repeatWindowDays).Format(dateLayout)
+	recentMatches, err := pl.mdb.ListSince(ctx, since)
+	if err != nil {
+		log.Printf("Could not get match history from DB: %s\n", err)
+	}
+
+	// leave out anything from the day itself, which is what's being matched
+	var before []matchRecord
+	for _, record := range recentMatches {
+		if record.date < day.Format(dateLayout) {
+			before = append(before, record)
+		}
+	}
+	return before
 }
 
 func (pl *PairingLogic) endofbatch(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+const pairNowMessage = "Hi you two! You both asked to pair right now, so you've been matched%v :)\n\nHave fun!"
+
+// people who `pair now` are matched with whoever else asks within this long
+var pairNowWindow = 30 * time.Minute
+
+// fits says whether two `pair now` requests can be matched together: they're
+// for the same stream, or one of them doesn't mind which, and neither of them
+// has blocked the other
+func (p pairNowRequest) fits(other pairNowRequest) bool {
+	if contains(p.blocked, other.id) || contains(other.blocked, p.id) {
+		return false
+	}
+	return p.stream == other.stream || p.stream == "any" || other.stream == "any"
+}
+
+// pairNowStream is the stream a `pair now` match is in: the one they asked
+// for, if either of them asked for one
+func pairNowStream(one, two pairNowRequest) string {
+	if one.stream == "any" {
+		return two.stream
+	}
+	return one.stream
+}
+
+// pairNow matches rec with whoever's been waiting to pair in stream ("any"
+// for anyone) for less than pairNowWindow, and messages them both. If nobody
+// has, rec waits for the next person instead. It returns what to tell rec
+func (pl *PairingLogic) pairNow(ctx context.Context, rec Recurser, stream string) (string, error) {
+	botPassword, err := pl.adb.GetKey(ctx, "apiauth", "key")
+	if err != nil {
+		log.Println("Something weird happened trying to read the auth token from the database")
+	}
+
+	// like `streams`, a typo shouldn't leave them waiting where nobody else will be
+	if stream != "any" {
+		zulipStreams, err := pl.sl.listStreams(ctx, botPassword)
+		if err != nil {
+			log.Printf("Could not get the list of streams from zulip: %s\n", err)
+		}
+		if len(zulipStreams) > 0 {
+			found, problem := checkStreams([]string{stream}, zulipStreams)
+			if problem != "" {
+				return problem, nil
+			}
+			stream = found[0]
+		}
+	}
+
+	now := time.Now()
+	request := pairNowRequest{
+		id:     rec.id,
+		name:   rec.name,
+		email:  rec.email,
+		stream: stream,
+		since:  now,
+	}
+	for id := range rec.blocked {
+		request.blocked = append(request.blocked, id)
+	}
+	partner, found, err := pl.mdb.PairNow(ctx, request, now.Add(-pairNowWindow))
+	if err != nil {
+		return writeErrorMessage, err
+	}
+
+	minutes := int(pairNowWindow.Minutes())
+	if !found {
+		if stream == "any" {
+			return fmt.Sprintf("OK! I'll match you with the next person who asks to `pair now` in the next %v minutes, and message you both.", minutes), nil
+		}
+		return fmt.Sprintf("OK! I'll match you with the next person who asks to `pair now` in `%v` in the next %v minutes, and message you both.", stream, minutes), nil
+	}
+
+	// it's in their history like any other match, so they're asked about it in the evening too
+	stream = pairNowStream(request, partner)
+	record := matchRecord{
+		date:    now.Format(dateLayout),
+		stream:  stream,
+		members: []string{partner.id, rec.id},
+		names:   map[string]string{partner.id: partner.name, rec.id: rec.name},
+	}
+	if err := pl.mdb.Add(ctx, record); err != nil {
+		log.Printf("Could not record match in stream %v: %s\n", stream, err)
+	}
+
+	var in string
+	if stream != "any" {
+		in = " in " + formatList([]string{stream})
+	}
+	to := partner.email + ", " + rec.email
+	if err := pl.un.sendUserMessage(ctx, botPassword, to, fmt.Sprintf(pairNowMessage, in)); err != nil {
+		log.Printf("Error when trying to send pair now message to %s: %s\n", to, err)
+	}
+	log.Printf("%s were matched right away in stream %v\n", partner.email+" and "+rec.email, stream)
+
+	return fmt.Sprintf("You're matched with %v! I've sent you both a message so you can find each other.", partner.name), nil
+}
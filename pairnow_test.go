@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestPairNowFits(t *testing.T) {
+	rust := pairNowRequest{id: "1", stream: "rust"}
+	tests := []struct {
+		testName     string
+		other        pairNowRequest
+		wantedFits   bool
+		wantedStream string
+	}{
+		{"same_stream", pairNowRequest{id: "2", stream: "rust"}, true, "rust"},
+		{"other_stream", pairNowRequest{id: "2", stream: "go"}, false, ""},
+		{"anyone", pairNowRequest{id: "2", stream: "any"}, true, "rust"},
+		{"blocked", pairNowRequest{id: "2", stream: "rust", blocked: []string{"1"}}, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			if rust.fits(tt.other) != tt.wantedFits || tt.other.fits(rust) != tt.wantedFits {
+				t.Errorf("fits was %v, wanted %v\n", rust.fits(tt.other), tt.wantedFits)
+			}
+			if !tt.wantedFits {
+				return
+			}
+			if got := pairNowStream(rust, tt.other); got != tt.wantedStream {
+				t.Errorf("stream was %v, wanted %v\n", got, tt.wantedStream)
+			}
+			if got := pairNowStream(tt.other, rust); got != tt.wantedStream {
+				t.Errorf("stream was %v, wanted %v\n", got, tt.wantedStream)
+			}
+		})
+	}
+}
@@ -4,8 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
-	"strings"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type parsingErr struct{ msg string }
@@ -21,10 +22,71 @@ func parseCmd(cmdStr string) (string, []string, error) {
 		"unsubscribe",
 		"help",
 		"schedule",
-        "streams",
+		"streams",
+		"skip",
+		"unskip",
+		"skips",
+		"topics",
+		"history",
+		"feedback",
+		"noshow",
+		"decline",
+		"cancel",
+		"pair",
+		"yes",
+		"no",
+		"rate",
+		"pause",
+		"resume",
+		"status",
+		"preview",
+		"block",
+		"unblock",
+		"blocked",
+		"prefer",
+		"unprefer",
+		"level",
+		"role",
+		"levels",
+		"languages",
+		"timezone",
+		"hours"}
+
+	// commands that don't make sense without arguments
+	var argsRequiredList = []string{
+		"cancel",
+		"pair",
+		"feedback",
+		"rate",
+		"schedule",
+		"streams",
 		"skip",
 		"unskip",
-		"status"}
+		"block",
+		"unblock",
+		"prefer",
+		"unprefer",
+		"level",
+		"role",
+		"levels",
+		"languages",
+		"timezone",
+		"hours"}
+
+	// commands that don't take any arguments at all
+	var noArgsList = []string{
+		"decline",
+		"yes",
+		"no",
+		"subscribe",
+		"unsubscribe",
+		"help",
+		"skips",
+		"topics",
+		"resume",
+		"status",
+		"preview",
+		"blocked"}
 
 	var daysList = []string{
 		"monday",
@@ -35,16 +97,14 @@ func parseCmd(cmdStr string) (string, []string, error) {
 		"saturday",
 		"sunday"}
 
-    // TODO: how to maintain list of topics? by stream name? free for all text?
-    //var streamsList = []string{
-    //}
-
 	// convert the string to a slice
 	// after this, we have a value "cmd" of type []string
 	// where cmd[0] is the command and cmd[1:] are any arguments
 	space := regexp.MustCompile(`\s+`)
 	cmdStr = space.ReplaceAllString(cmdStr, ` `)
 	cmdStr = strings.TrimSpace(cmdStr)
+	// time zone names are case-sensitive, so keep the original around
+	rawCmd := strings.Split(cmdStr, ` `)
 	cmdStr = strings.ToLower(cmdStr)
 	cmd := strings.Split(cmdStr, ` `)
 
@@ -57,24 +117,110 @@ func parseCmd(cmdStr string) (string, []string, error) {
 
 	// if there's a valid command and if there's no arguments
 	case contains(cmdList, cmd[0]) && len(cmd) == 1:
-		if cmd[0] == "schedule" || cmd[0] == "streams" || cmd[0] == "skip" || cmd[0] == "unskip" {
+		if contains(argsRequiredList, cmd[0]) {
 			err = &parsingErr{"the user issued a command without args, but it reqired args"}
 			return "help", nil, err
 		}
+		// "yes" and "no" are answers to the evening question about whether they paired
+		if cmd[0] == "yes" || cmd[0] == "no" {
+			return "feedback", []string{cmd[0]}, err
+		}
 		return cmd[0], nil, err
 
 	// if there's a valid command and there's some arguments
 	case contains(cmdList, cmd[0]) && len(cmd) > 1:
 		switch {
-		case cmd[0] == "subscribe" || cmd[0] == "unsubscribe" || cmd[0] == "help" || cmd[0] == "status":
+		case contains(noArgsList, cmd[0]):
 			err = &parsingErr{"the user issued a command with args, but it disallowed args"}
 			return "help", nil, err
-		case cmd[0] == "skip" && (len(cmd) != 2 || cmd[1] != "tomorrow"):
-			err = &parsingErr{"the user issued SKIP with malformed arguments"}
+		case cmd[0] == "skip" || cmd[0] == "unskip":
+			// "next week" is two words, so put the dates back together into one argument.
+			// which days they are depends on the user's time zone, so that's left to dispatch
+			when := strings.Join(cmd[1:], " ")
+			if cmd[0] == "unskip" && when == "all" {
+				return cmd[0], []string{when}, err
+			}
+			if _, dateErr := parseDates(when, time.Now()); dateErr != nil {
+				err = &parsingErr{fmt.Sprintf("the user issued %v with malformed arguments", strings.ToUpper(cmd[0]))}
+				return "help", nil, err
+			}
+			return cmd[0], []string{when}, err
+		case cmd[0] == "feedback" || cmd[0] == "rate":
+			// feedback yes, feedback no, feedback 4, rate 4 (or rate 4/5)
+			answers := []string{"yes", "no", "1", "2", "3", "4", "5"}
+			if cmd[0] == "rate" {
+				answers = answers[2:]
+			}
+			answer := strings.TrimSuffix(cmd[1], "/5")
+			if len(cmd) != 2 || !contains(answers, answer) {
+				err = &parsingErr{fmt.Sprintf("the user issued %v with malformed arguments", strings.ToUpper(cmd[0]))}
+				return "help", nil, err
+			}
+			return "feedback", []string{answer}, err
+		case cmd[0] == "cancel":
+			// "cancel today" is the same as "decline"
+			if len(cmd) != 2 || cmd[1] != "today" {
+				err = &parsingErr{"the user issued CANCEL with malformed arguments"}
+				return "help", nil, err
+			}
+			return "decline", nil, err
+		case cmd[0] == "pair":
+			// pair now, pair now rust, pair now "data science"
+			stream := splitQuoted(strings.Join(cmd[2:], " "))
+			if cmd[1] != "now" || len(stream) > 1 {
+				err = &parsingErr{"the user issued PAIR with malformed arguments"}
+				return "help", nil, err
+			}
+			if len(stream) == 0 {
+				stream = []string{"any"}
+			}
+			return cmd[0], stream, err
+		case cmd[0] == "history":
+			// history 30d, history page 2, history 30d page 2
+			if _, _, ok := parseHistoryArgs(cmd[1:]); !ok {
+				err = &parsingErr{"the user issued HISTORY with malformed arguments"}
+				return "help", nil, err
+			}
+			return cmd[0], cmd[1:], err
+		case cmd[0] == "pause":
+			// pause until friday, pause until 2026-11-02, ...
+			if len(cmd) < 3 || cmd[1] != "until" {
+				err = &parsingErr{"the user issued PAUSE with malformed arguments"}
+				return "help", nil, err
+			}
+			when := strings.Join(cmd[2:], " ")
+			if dates, dateErr := parseDates(when, time.Now()); dateErr != nil || len(dates) != 1 {
+				err = &parsingErr{"the user issued PAUSE with malformed arguments"}
+				return "help", nil, err
+			}
+			return cmd[0], []string{when}, err
+		case cmd[0] == "block" || cmd[0] == "unblock" || cmd[0] == "prefer" || cmd[0] == "unprefer" || cmd[0] == "noshow":
+			// a zulip mention like @**Jane Doe** has spaces in it,
+			// so put the name back together into one argument
+			return cmd[0], []string{strings.Join(cmd[1:], " ")}, err
+		case cmd[0] == "level" && (len(cmd) != 2 || !contains(experienceLevels, cmd[1])):
+			err = &parsingErr{"the user issued LEVEL with malformed arguments"}
+			return "help", nil, err
+		case cmd[0] == "role" && (len(cmd) != 2 || !contains([]string{"mentor", "mentee", "peer"}, cmd[1])):
+			err = &parsingErr{"the user issued ROLE with malformed arguments"}
 			return "help", nil, err
-		case cmd[0] == "unskip" && (len(cmd) != 2 || cmd[1] != "tomorrow"):
-			err = &parsingErr{"the user issued UNSKIP with malformed arguments"}
+		case cmd[0] == "levels" && (len(cmd) != 2 || !contains([]string{"similar", "across", "any"}, cmd[1])):
+			err = &parsingErr{"the user issued LEVELS with malformed arguments"}
 			return "help", nil, err
+		case cmd[0] == "timezone":
+			if len(cmd) != 2 {
+				err = &parsingErr{"the user issued TIMEZONE with malformed arguments"}
+				return "help", nil, err
+			}
+			return cmd[0], rawCmd[1:], err
+		case cmd[0] == "hours":
+			// people might write 10:00 - 16:00 too
+			window := strings.Join(cmd[1:], "")
+			if _, _, ok := parseHours(window); !ok && window != "any" {
+				err = &parsingErr{"the user issued HOURS with malformed arguments"}
+				return "help", nil, err
+			}
+			return cmd[0], []string{window}, err
 		case cmd[0] == "schedule":
 			for _, v := range cmd[1:] {
 				if !contains(daysList, v) {
@@ -82,28 +228,40 @@ func parseCmd(cmdStr string) (string, []string, error) {
 					return "help", nil, err
 				}
 			}
-			fallthrough
+			return cmd[0], cmd[1:], err
 		case cmd[0] == "streams":
+			// stream names with spaces in them are quoted, like `streams "data science" 1`
+			args := splitQuoted(strings.Join(cmd[1:], " "))
+			// empty quotes or mentions leave nothing at all
+			if len(args) == 0 {
+				err = &parsingErr{"the user issued STREAMS with malformed arguments"}
+				return "help", nil, err
+			}
+			// streams can be for just one day of the week, like "streams monday rust 1"
+			streams := args
+			if contains(daysList, streams[0]) {
+				streams = streams[1:]
+				// "streams monday default" goes back to their usual streams on mondays
+				if len(streams) == 1 && streams[0] == "default" {
+					return cmd[0], args, err
+				}
+			}
 			// check that number of arguments after "streams" is even
-			if len(cmd) == 1 || (len(cmd) - 1) % 2 == 1 {
+			if len(streams) == 0 || len(streams)%2 == 1 {
 				err = &parsingErr{"the user issued STREAMS with malformed arguments"}
 				return "help", nil, err
 			}
-			// check that arguments alternate between valid stream and integer
-			for i := 1; i < len(cmd); i += 2{
-				// FIXME: not sure how to get list of streams from zulip
-				//if !contains(streamsList, cmd[i]) {
-				//	err = &parsingErr{"the user issued STREAMS with malformed arguments"}
-				//	return "help", nil, err
-				//}
+			// check that arguments alternate between stream and integer.
+			// whether the streams exist is up to zulip, so dispatch checks that
+			for i := 0; i < len(streams); i += 2 {
 				// check that next element is integer and convert to appropriate type
 				// FIXME: is it possible to make a list of str and ints? list of (str, int)?
-				if _, err := strconv.Atoi(cmd[i + 1]); err != nil {
+				if _, err := strconv.Atoi(streams[i+1]); err != nil {
 					err = &parsingErr{"the user issued STREAMS with malformed arguments"}
 					return "help", nil, err
 				}
 			}
-			fallthrough
+			return cmd[0], args, err
 		default:
 			return cmd[0], cmd[1:], err
 		}
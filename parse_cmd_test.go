@@ -31,6 +31,26 @@ var tableNoArgs = []struct {
 	{"help_wrong_usage", "help me", "help", nil, true},
 	{"status_correct_usage", "status", "status", nil, false},
 	{"status_wrong_usage", "status me", "help", nil, true},
+	{"skips_correct_usage", "skips", "skips", nil, false},
+	{"skips_wrong_usage", "skips friday", "help", nil, true},
+	{"topics_correct_usage", "topics", "topics", nil, false},
+	{"topics_wrong_usage", "topics rust", "help", nil, true},
+	{"history_correct_usage", "history", "history", nil, false},
+	{"noshow_correct_usage", "noshow", "noshow", nil, false},
+	{"decline_correct_usage", "decline", "decline", nil, false},
+	{"decline_wrong_usage", "decline tomorrow", "help", nil, true},
+	{"cancel_wrong_usage", "cancel", "help", nil, true},
+	{"pair_wrong_usage", "pair", "help", nil, true},
+	{"yes_correct_usage", "yes", "feedback", nil, false},
+	{"no_correct_usage", "No", "feedback", nil, false},
+	{"yes_wrong_usage", "yes please", "help", nil, true},
+	{"pause_correct_usage", "pause", "pause", nil, false},
+	{"resume_correct_usage", "resume", "resume", nil, false},
+	{"resume_wrong_usage", "resume now", "help", nil, true},
+	{"preview_correct_usage", "preview", "preview", nil, false},
+	{"preview_wrong_usage", "preview tomorrow", "help", nil, true},
+	{"blocked_correct_usage", "blocked", "blocked", nil, false},
+	{"blocked_wrong_usage", "blocked me", "help", nil, true},
 }
 
 func TestParseCmdNoArgs(t *testing.T) {
@@ -66,13 +86,83 @@ var tableWithArgs = []struct {
 	{"schedule_weekend_only", "schedule sunday", "schedule", []string{"sunday"}, false},
 	{"schedule_wrong_usage", "schedule", "help", nil, true},
 	{"skip_correct_usage", "skip tomorrow", "skip", []string{"tomorrow"}, false},
-	{"skip_wrong_usage", "skip monday", "help", nil, true},
+	{"skip_weekday", "skip monday", "skip", []string{"monday"}, false},
+	{"skip_next_week", "skip next week", "skip", []string{"next week"}, false},
+	{"skip_date", "skip 2026-10-21", "skip", []string{"2026-10-21"}, false},
+	{"skip_range", "skip 10/20-10/24", "skip", []string{"10/20-10/24"}, false},
 	{"skip_wrong_usage", "skip whenever", "help", nil, true},
+	{"skip_wrong_usage", "skip 2026-13-01", "help", nil, true},
+	{"skip_wrong_usage", "skip all", "help", nil, true},
 	{"skip_wrong_usage", "skip", "help", nil, true},
 	{"unskip_correct_usage", "unskip tomorrow", "unskip", []string{"tomorrow"}, false},
+	{"unskip_weekday", "unskip friday", "unskip", []string{"friday"}, false},
+	{"unskip_all", "unskip all", "unskip", []string{"all"}, false},
 	{"unskip_wrong_usage", "unskip today", "help", nil, true},
-	{"unskip_wrong_usage", "unskip friday", "help", nil, true},
 	{"unskip_wrong_usage", "unskip", "help", nil, true},
+	{"streams_correct_usage", "streams any 2 math 1", "streams", []string{"any", "2", "math", "1"}, false},
+	{"streams_one_day", "streams monday rust 1", "streams", []string{"monday", "rust", "1"}, false},
+	{"streams_day_default", "streams friday default", "streams", []string{"friday", "default"}, false},
+	{"streams_quoted", "streams \"Data Science\" 1 any 2", "streams", []string{"data science", "1", "any", "2"}, false},
+	{"streams_mention", "streams friday #**data science** 1", "streams", []string{"friday", "data science", "1"}, false},
+	{"streams_wrong_usage", "streams monday rust", "help", nil, true},
+	{"streams_wrong_usage", "streams monday", "help", nil, true},
+	{"streams_wrong_usage", "streams rust one", "help", nil, true},
+	{"streams_wrong_usage", "streams \"\"", "help", nil, true},
+	{"streams_wrong_usage", "streams #****", "help", nil, true},
+	{"history_window", "history 30d", "history", []string{"30d"}, false},
+	{"history_page", "history 30d page 2", "history", []string{"30d", "page", "2"}, false},
+	{"history_wrong_usage", "history 30", "help", nil, true},
+	{"history_wrong_usage", "history page", "help", nil, true},
+	{"noshow_mention", "noshow @**Jane Doe**", "noshow", []string{"@**jane doe**"}, false},
+	{"feedback_yes", "feedback yes", "feedback", []string{"yes"}, false},
+	{"feedback_rating", "feedback 4", "feedback", []string{"4"}, false},
+	{"rate_correct_usage", "rate 5", "feedback", []string{"5"}, false},
+	{"rate_out_of_five", "rate 3/5", "feedback", []string{"3"}, false},
+	{"rate_wrong_usage", "rate 6", "help", nil, true},
+	{"rate_wrong_usage", "rate yes", "help", nil, true},
+	{"rate_wrong_usage", "rate", "help", nil, true},
+	{"feedback_wrong_usage", "feedback maybe", "help", nil, true},
+	{"cancel_today", "cancel today", "decline", nil, false},
+	{"pair_now", "pair now", "pair", []string{"any"}, false},
+	{"pair_now_stream", "pair now Rust", "pair", []string{"rust"}, false},
+	{"pair_now_quoted", "pair now \"data science\"", "pair", []string{"data science"}, false},
+	{"pair_wrong_usage", "pair later", "help", nil, true},
+	{"pair_wrong_usage", "pair now rust go", "help", nil, true},
+	{"cancel_wrong_usage", "cancel tomorrow", "help", nil, true},
+	{"block_mention", "block @**Jane Doe**", "block", []string{"@**jane doe**"}, false},
+	{"block_mention_with_id", "block @**Jane Doe|1234**", "block", []string{"@**jane doe|1234**"}, false},
+	{"block_email", "block jane@example.com", "block", []string{"jane@example.com"}, false},
+	{"block_wrong_usage", "block", "help", nil, true},
+	{"unblock_mention", "unblock   @**Jane  Doe**", "unblock", []string{"@**jane doe**"}, false},
+	{"unblock_wrong_usage", "unblock", "help", nil, true},
+	{"prefer_mention", "prefer @**Jane Doe**", "prefer", []string{"@**jane doe**"}, false},
+	{"prefer_wrong_usage", "prefer", "help", nil, true},
+	{"unprefer_mention", "unprefer @**Jane Doe**", "unprefer", []string{"@**jane doe**"}, false},
+	{"level_correct_usage", "level Beginner", "level", []string{"beginner"}, false},
+	{"level_wrong_usage", "level expert", "help", nil, true},
+	{"level_no_args", "level", "help", nil, true},
+	{"role_correct_usage", "role mentor", "role", []string{"mentor"}, false},
+	{"role_wrong_usage", "role mentor mentee", "help", nil, true},
+	{"levels_correct_usage", "levels across", "levels", []string{"across"}, false},
+	{"levels_wrong_usage", "levels same", "help", nil, true},
+	{"languages_correct_usage", "languages Go", "languages", []string{"go"}, false},
+	{"languages_several", "languages Go Rust python", "languages", []string{"go", "rust", "python"}, false},
+	{"languages_no_args", "languages", "help", nil, true},
+	{"timezone_keeps_case", "timezone America/Los_Angeles", "timezone", []string{"America/Los_Angeles"}, false},
+	{"timezone_wrong_usage", "timezone new york", "help", nil, true},
+	{"hours_correct_usage", "hours 10:00-16:00", "hours", []string{"10:00-16:00"}, false},
+	{"hours_with_spaces", "hours 9 - 17", "hours", []string{"9-17"}, false},
+	{"hours_any", "hours any", "hours", []string{"any"}, false},
+	{"hours_wrong_usage", "hours 10:00-25:00", "help", nil, true},
+	{"hours_past_midnight", "hours 22:00-02:00", "hours", []string{"22:00-02:00"}, false},
+	{"hours_wrong_usage", "hours 9-5", "help", nil, true},
+	{"hours_wrong_usage", "hours 9:00-5:00", "help", nil, true},
+	{"hours_no_args", "hours", "help", nil, true},
+	{"pause_until_date", "pause until 2026-11-02", "pause", []string{"2026-11-02"}, false},
+	{"pause_until_weekday", "pause until Friday", "pause", []string{"friday"}, false},
+	{"pause_wrong_usage", "pause 2026-11-02", "help", nil, true},
+	{"pause_wrong_usage", "pause until next week", "help", nil, true},
+	{"pause_wrong_usage", "pause until", "help", nil, true},
 }
 
 func TestParseCmdWithArgs(t *testing.T) {
@@ -90,12 +180,15 @@ func TestParseCmdWithArgs(t *testing.T) {
 						t.Errorf("Wrong argument %v for command %v\n", gotArgs[i], gotCmd)
 					}
 				}
-			case "skip":
-				if gotArgs[0] != "tomorrow" {
-					t.Errorf("Wrong argument %v for command %v\n", gotArgs[0], gotCmd)
+			case "streams", "history", "feedback", "noshow", "decline", "pair",
+				"block", "unblock", "prefer", "unprefer", "level", "role", "levels", "languages", "timezone", "hours":
+				for i, arg := range gotArgs {
+					if arg != tt.wantedArgs[i] {
+						t.Errorf("Wrong argument %v for command %v\n", arg, gotCmd)
+					}
 				}
-			case "unskip":
-				if gotArgs[0] != "tomorrow" {
+			case "skip", "unskip", "pause":
+				if gotArgs[0] != tt.wantedArgs[0] {
 					t.Errorf("Wrong argument %v for command %v\n", gotArgs[0], gotCmd)
 				}
 			default:
@@ -145,3 +238,25 @@ func TestParseCmdMisc(t *testing.T) {
 		})
 	}
 }
+
+func TestFindRecurser(t *testing.T) {
+	recursers := []Recurser{
+		{id: "1", name: "Jane Doe", email: "jane@example.com"},
+		{id: "2", name: "Jane Doe", email: "other.jane@example.com"},
+	}
+	for _, tt := range []struct {
+		who    string
+		wanted string
+	}{
+		{"@**jane doe**", "1"},
+		{"@_**jane doe|2**", "2"},
+		{"other.jane@example.com", "2"},
+		{"jane doe", "1"},
+		{"@**john doe**", ""},
+	} {
+		got, ok := findRecurser(recursers, tt.who)
+		if ok != (tt.wanted != "") || got.id != tt.wanted {
+			t.Errorf("findRecurser(%v) got %v, wanted %v\n", tt.who, got.id, tt.wanted)
+		}
+	}
+}
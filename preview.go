@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// previews always use the same seed unless they ask for another one,
+// so two previews of the same day agree with each other
+const previewSeed int64 = 1
+
+// matches go out every day at this hour (UTC), see cron.yaml
+const matchHourUTC = 4
+
+// matchPreview is what /match/preview sends back
+type matchPreview struct {
+	Date    string         `json:"date"`
+	Seed    int64          `json:"seed"`
+	Groups  []previewGroup `json:"groups"`
+	LeftOut []string       `json:"leftOut"`
+}
+
+type previewGroup struct {
+	Stream  string   `json:"stream"`
+	Members []string `json:"members"`
+}
+
+func newMatchPreview(day time.Time, seed int64, result matchResult) matchPreview {
+	preview := matchPreview{
+		Date:    day.Format(dateLayout),
+		Seed:    seed,
+		Groups:  []previewGroup{},
+		LeftOut: []string{},
+	}
+	for _, g := range result.groups {
+		pg := previewGroup{Stream: g.stream}
+		for _, member := range g.members {
+			pg.Members = append(pg.Members, member.name)
+		}
+		preview.Groups = append(preview.Groups, pg)
+	}
+	for _, recurser := range result.leftOut {
+		preview.LeftOut = append(preview.LeftOut, recurser.name)
+	}
+	return preview
+}
+
+// String formats the preview for a zulip message
+func (p matchPreview) String() string {
+	if len(p.Groups) == 0 && len(p.LeftOut) == 0 {
+		return fmt.Sprintf("Nobody would be matched on %v.", p.Date)
+	}
+	msg := fmt.Sprintf("Here's who would be matched on %v (seed %v):\n", p.Date, p.Seed)
+	for _, g := range p.Groups {
+		msg += fmt.Sprintf("* `%v`: %v\n", g.Stream, strings.Join(g.Members, ", "))
+	}
+	if len(p.LeftOut) > 0 {
+		msg += fmt.Sprintf("\nLeft out: %v", strings.Join(p.LeftOut, ", "))
+	}
+	return msg
+}
+
+// nextMatchDay is when the next daily match will run
+func nextMatchDay(now time.Time) time.Time {
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day(), matchHourUTC, 0, 0, 0, time.UTC)
+	if !now.Before(next) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// previewMatches works out tomorrow's matches without messaging anyone
+func (pl *PairingLogic) previewMatches(ctx context.Context, seed int64) (matchPreview, error) {
+	day := nextMatchDay(time.Now())
+	input, _, err := pl.loadMatchInput(ctx, day, seed)
+	if err != nil {
+		return matchPreview{}, err
+	}
+	return newMatchPreview(day, seed, pl.matcher.Match(input)), nil
+}
+
+// replay re-runs the matching for a past date with the seed and the
+// recursers that were saved when it first ran. It uses the matcher that's
+// configured now, so change PB_MATCHER back if it's been changed since
+func (pl *PairingLogic) replay(ctx context.Context, date string) (matchPreview, error) {
+	if _, err := time.Parse(dateLayout, date); err != nil {
+		return matchPreview{}, err
+	}
+	run, err := pl.mdb.GetRun(ctx, date)
+	if err != nil {
+		return matchPreview{}, err
+	}
+
+	// everyone's local pairing day depends on exactly when it ran
+	day := run.ranAt
+	result := pl.matcher.Match(newMatchInput(run.recursers, run.history, day, run.seed))
+	return newMatchPreview(day, run.seed, result), nil
+}
+
+// "preview" shows organizers what the next "match" would do, as JSON.
+// It needs the admin token from the database as a bearer token
+func (pl *PairingLogic) preview(w http.ResponseWriter, r *http.Request) {
+	adminAuth, err := pl.adb.GetKey(r.Context(), "adminauth", "token")
+	if err != nil {
+		log.Println("Something weird happened trying to read the admin token from the database")
+	}
+	if err != nil || adminAuth == "" || r.Header.Get("Authorization") != "Bearer "+adminAuth {
+		http.NotFound(w, r)
+		return
+	}
+
+	seed := previewSeed
+	if s := r.URL.Query().Get("seed"); s != "" {
+		if seed, err = strconv.ParseInt(s, 10, 64); err != nil {
+			http.Error(w, "seed must be a number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	preview, err := pl.previewMatches(r.Context(), seed)
+	if err != nil {
+		log.Printf("Could not preview matches: %s\n", err)
+		http.Error(w, "could not preview matches", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(preview); err != nil {
+		log.Println(err)
+	}
+}
+
+// admins can use admin-only commands like "preview". The owner is always an admin,
+// and more zulip user IDs can be added with PB_ADMINS (comma-separated)
+func isAdmin(userID string) bool {
+	if userID == ownerID {
+		return true
+	}
+	for _, id := range strings.Split(os.Getenv("PB_ADMINS"), ",") {
+		if strings.TrimSpace(id) == userID {
+			return true
+		}
+	}
+	return false
+}
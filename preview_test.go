@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestNextMatchDay(t *testing.T) {
+	var tableNextMatchDay = []struct {
+		now    time.Time
+		wanted time.Time
+	}{
+		{time.Date(2026, 10, 19, 3, 59, 0, 0, time.UTC), time.Date(2026, 10, 19, matchHourUTC, 0, 0, 0, time.UTC)},
+		{time.Date(2026, 10, 19, 4, 0, 0, 0, time.UTC), time.Date(2026, 10, 20, matchHourUTC, 0, 0, 0, time.UTC)},
+		{time.Date(2026, 10, 19, 15, 0, 0, 0, time.UTC), time.Date(2026, 10, 20, matchHourUTC, 0, 0, 0, time.UTC)},
+		// 22:00 on the 19th in New York is 02:00 on the 20th in UTC, before that day's run
+		{time.Date(2026, 10, 19, 22, 0, 0, 0, time.FixedZone("EDT", -4*60*60)), time.Date(2026, 10, 20, matchHourUTC, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tableNextMatchDay {
+		if got := nextMatchDay(tt.now); !got.Equal(tt.wanted) {
+			t.Errorf("at %v: got %v, wanted %v\n", tt.now, got, tt.wanted)
+		}
+	}
+}
+
+func TestMatchPreview(t *testing.T) {
+	day := time.Date(2026, 10, 19, matchHourUTC, 0, 0, 0, time.UTC)
+
+	empty := newMatchPreview(day, 7, matchResult{})
+	if got, wanted := empty.String(), "Nobody would be matched on 2026-10-19."; got != wanted {
+		t.Errorf("got %q, wanted %q\n", got, wanted)
+	}
+	// empty lists, not null, so the JSON is the same shape either way
+	js, err := json.Marshal(empty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, wanted := string(js), `{"date":"2026-10-19","seed":7,"groups":[],"leftOut":[]}`; got != wanted {
+		t.Errorf("got %v, wanted %v\n", got, wanted)
+	}
+
+	preview := newMatchPreview(day, 7, matchResult{
+		groups: []group{{
+			stream:  "rust",
+			members: []Recurser{newTestRecurser("1", nil), newTestRecurser("2", nil)},
+		}},
+		leftOut: []Recurser{newTestRecurser("3", nil)},
+	})
+	wanted := "Here's who would be matched on 2026-10-19 (seed 7):\n* `rust`: recurser 1, recurser 2\n\nLeft out: recurser 3"
+	if got := preview.String(); got != wanted {
+		t.Errorf("got %q, wanted %q\n", got, wanted)
+	}
+	js, err = json.Marshal(preview)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantedJSON := `{"date":"2026-10-19","seed":7,"groups":[{"stream":"rust","members":["recurser 1","recurser 2"]}],"leftOut":["recurser 3"]}`
+	if got := string(js); got != wantedJSON {
+		t.Errorf("got %v, wanted %v\n", got, wantedJSON)
+	}
+}
+
+// a replayDB has one saved run, and matches that have changed since it ran
+type replayDB struct {
+	MockMatchHistoryDB
+	run     matchRun
+	matches []matchRecord
+}
+
+func (db *replayDB) GetRun(ctx context.Context, date string) (matchRun, error) {
+	return db.run, nil
+}
+
+func (db *replayDB) ListSince(ctx context.Context, date string) ([]matchRecord, error) {
+	return db.matches, nil
+}
+
+func TestReplay(t *testing.T) {
+	matcher, err := newMatcher("history", matcherConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recursers []Recurser
+	for _, id := range []string{"1", "2", "3", "4"} {
+		recursers = append(recursers, newTestRecurser(id, map[string]int{"any": 1}))
+	}
+	run := matchRun{
+		date:      "2026-10-19",
+		ranAt:     time.Date(2026, 10, 19, matchHourUTC, 0, 0, 0, time.UTC),
+		seed:      42,
+		recursers: recursers,
+		history: []matchRecord{
+			{date: "2026-10-18", stream: "any", members: []string{"1", "2"}},
+			{date: "2026-10-18", stream: "any", members: []string{"3", "4"}},
+		},
+	}
+	// if replay went by these, it'd have to match 1 with 2 and 3 with 4
+	db := &replayDB{run: run, matches: []matchRecord{
+		{date: "2026-10-17", stream: "any", members: []string{"1", "3"}},
+		{date: "2026-10-17", stream: "any", members: []string{"1", "4"}},
+		{date: "2026-10-17", stream: "any", members: []string{"2", "3"}},
+		{date: "2026-10-17", stream: "any", members: []string{"2", "4"}},
+	}}
+	pl := &PairingLogic{mdb: db, matcher: matcher}
+
+	got, err := pl.replay(context.Background(), run.date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := matcher.Match(newMatchInput(run.recursers, run.history, run.ranAt, run.seed))
+	if wanted := newMatchPreview(run.ranAt, run.seed, result); !reflect.DeepEqual(got, wanted) {
+		t.Errorf("got %v, wanted %v\n", got, wanted)
+	}
+	for _, g := range got.Groups {
+		members := append([]string(nil), g.Members...)
+		sort.Strings(members)
+		if reflect.DeepEqual(members, []string{"recurser 1", "recurser 2"}) || reflect.DeepEqual(members, []string{"recurser 3", "recurser 4"}) {
+			t.Errorf("replay matched %v again, so it didn't use the run's history\n", g.Members)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// splitQuoted splits the arguments to a command on spaces, except inside
+// quotes or a zulip stream mention, so that stream names can have spaces
+// in them: `"data science" 1` and `#**data science** 1` are both two arguments
+func splitQuoted(s string) []string {
+	var args []string
+	rest := strings.TrimSpace(s)
+	for rest != "" {
+		var arg string
+		switch {
+		case strings.HasPrefix(rest, "#**"):
+			arg, rest = cutAt(rest[len("#**"):], "**")
+		case strings.HasPrefix(rest, `"`):
+			arg, rest = cutAt(rest[len(`"`):], `"`)
+		// phones like to turn quotes into curly ones
+		case strings.HasPrefix(rest, "“"):
+			arg, rest = cutAt(rest[len("“"):], "”")
+		default:
+			arg, rest = cutAt(rest, " ")
+		}
+		if arg = strings.TrimSpace(arg); arg != "" {
+			args = append(args, arg)
+		}
+		rest = strings.TrimSpace(rest)
+	}
+	return args
+}
+
+// cutAt splits s around the first sep. If there isn't one, all of s comes first
+func cutAt(s, sep string) (string, string) {
+	if i := strings.Index(s, sep); i != -1 {
+		return s[:i], s[i+len(sep):]
+	}
+	return s, ""
+}
+
+// findStream looks up what someone typed among zulip's stream names.
+// Case, spaces, dashes and underscores don't matter, since people used
+// to be told to leave the spaces out. It returns the stream as it should
+// be stored (lowercase), or false and the closest stream name if there's
+// one that looks like a typo of it
+func findStream(name string, streams []string) (string, bool, string) {
+	key := streamKey(name)
+	suggestion := ""
+	best := maxTypoDistance + 1
+	for _, stream := range streams {
+		if streamKey(stream) == key {
+			return strings.ToLower(stream), true, ""
+		}
+		if d := editDistance(key, streamKey(stream)); d < best {
+			best = d
+			suggestion = strings.ToLower(stream)
+		}
+	}
+	return "", false, suggestion
+}
+
+// names further apart than this aren't suggested as corrections
+const maxTypoDistance = 2
+
+func streamKey(name string) string {
+	return strings.NewReplacer(" ", "", "-", "", "_", "").Replace(strings.ToLower(name))
+}
+
+// editDistance is how many single-letter insertions, deletions,
+// substitutions or swaps of neighbouring letters it takes to turn one into two
+func editDistance(one, two string) int {
+	a, b := []rune(one), []rune(two)
+	// d[i][j] is the distance between a[:i] and b[:j]
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+func min(first int, rest ...int) int {
+	for _, n := range rest {
+		if n < first {
+			first = n
+		}
+	}
+	return first
+}
+
+// checkStreams makes sure every stream in a `streams` command exists on
+// zulip, and gives back the names they should be stored under. "any" isn't a
+// stream, so it's always fine. If some don't exist, the message says which,
+// with suggestions for the ones that look like typos
+func checkStreams(names []string, streams []string) ([]string, string) {
+	var found []string
+	var problems []string
+	for _, name := range names {
+		if strings.EqualFold(name, "any") {
+			found = append(found, "any")
+			continue
+		}
+		stream, ok, suggestion := findStream(name, streams)
+		switch {
+		case ok:
+			found = append(found, stream)
+		case suggestion != "":
+			problems = append(problems, fmt.Sprintf("There's no stream called `%v`. Did you mean `%v`?", name, suggestion))
+		default:
+			problems = append(problems, fmt.Sprintf("There's no stream called `%v`.", name))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, strings.Join(problems, "\n") + "\nStream names with spaces in them need quotes, like `streams \"data science\" 1`."
+	}
+	return found, ""
+}
+
+// a topic is a stream, and who wants to pair in it on which days
+type topic struct {
+	stream string
+	people int
+	// which days of the week, in order
+	days []time.Weekday
+}
+
+// listTopics gathers up the streams people are using, busiest first
+func listTopics(recursers []Recurser) []topic {
+	people := make(map[string]map[string]bool)
+	days := make(map[string]map[time.Weekday]bool)
+	for _, r := range recursers {
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			day := strings.ToLower(d.String())
+			if scheduled, _ := r.schedule[day].(bool); !scheduled {
+				continue
+			}
+			streams, _ := r.streamsOn(day)
+			for stream, count := range streams {
+				if count <= 0 {
+					continue
+				}
+				if people[stream] == nil {
+					people[stream] = make(map[string]bool)
+					days[stream] = make(map[time.Weekday]bool)
+				}
+				people[stream][r.id] = true
+				days[stream][d] = true
+			}
+		}
+	}
+
+	var topics []topic
+	for stream := range people {
+		t := topic{stream: stream, people: len(people[stream])}
+		// weeks start on monday
+		for _, d := range []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday} {
+			if days[stream][d] {
+				t.days = append(t.days, d)
+			}
+		}
+		topics = append(topics, t)
+	}
+	sort.Slice(topics, func(i, j int) bool {
+		if topics[i].people != topics[j].people {
+			return topics[i].people > topics[j].people
+		}
+		return topics[i].stream < topics[j].stream
+	})
+	return topics
+}
+
+// String is like "`rust`: 3 people, on Mondays and Fridays"
+func (t topic) String() string {
+	people := fmt.Sprintf("%v people", t.people)
+	if t.people == 1 {
+		people = "1 person"
+	}
+	if len(t.days) == 7 {
+		return fmt.Sprintf("`%v`: %v, every day", t.stream, people)
+	}
+	var days []string
+	for _, d := range t.days {
+		days = append(days, d.String()+"s")
+	}
+	return fmt.Sprintf("`%v`: %v, on %v", t.stream, people, joinAnd(days))
+}
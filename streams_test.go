@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitQuoted(t *testing.T) {
+	var tableSplitQuoted = []struct {
+		input  string
+		wanted []string
+	}{
+		{"rust 1 any 2", []string{"rust", "1", "any", "2"}},
+		{`"data science" 1`, []string{"data science", "1"}},
+		{"“data science” 1", []string{"data science", "1"}},
+		{"#**data science** 1 #**rust** 2", []string{"data science", "1", "rust", "2"}},
+		{`"data science 1`, []string{"data science 1"}},
+		{`"" 1`, []string{"1"}},
+	}
+	for _, tt := range tableSplitQuoted {
+		if got := splitQuoted(tt.input); strings.Join(got, "|") != strings.Join(tt.wanted, "|") {
+			t.Errorf("splitQuoted(%q) got %q, wanted %q\n", tt.input, got, tt.wanted)
+		}
+	}
+}
+
+func TestCheckStreams(t *testing.T) {
+	zulipStreams := []string{"Rust", "Data Science", "pairing", "checkins"}
+
+	var tableCheckStreams = []struct {
+		input   []string
+		wanted  []string
+		problem string
+	}{
+		{[]string{"rust", "any"}, []string{"rust", "any"}, ""},
+		{[]string{"data science", "datascience", "data-science"}, []string{"data science", "data science", "data science"}, ""},
+		{[]string{"rsut"}, nil, "Did you mean `rust`?"},
+		{[]string{"pairng", "quilting"}, nil, "There's no stream called `quilting`."},
+	}
+	for _, tt := range tableCheckStreams {
+		got, problem := checkStreams(tt.input, zulipStreams)
+		if strings.Join(got, "|") != strings.Join(tt.wanted, "|") || !strings.Contains(problem, tt.problem) || (tt.problem == "") != (problem == "") {
+			t.Errorf("checkStreams(%q) got %q, %q, wanted %q, %q\n", tt.input, got, problem, tt.wanted, tt.problem)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	var tableEditDistance = []struct {
+		one, two string
+		wanted   int
+	}{
+		{"rust", "rust", 0},
+		{"rsut", "rust", 1},
+		{"rus", "rust", 1},
+		{"pairng", "pairing", 1},
+		{"go", "rust", 4},
+	}
+	for _, tt := range tableEditDistance {
+		if got := editDistance(tt.one, tt.two); got != tt.wanted {
+			t.Errorf("editDistance(%q, %q) got %v, wanted %v\n", tt.one, tt.two, got, tt.wanted)
+		}
+	}
+}
+
+func TestListTopics(t *testing.T) {
+	weekdays := map[string]interface{}{"monday": true, "tuesday": true, "wednesday": true, "thursday": true, "friday": true}
+	everyDay := map[string]interface{}{"monday": true, "tuesday": true, "wednesday": true, "thursday": true, "friday": true, "saturday": true, "sunday": true}
+	recursers := []Recurser{
+		{id: "1", schedule: weekdays, streams: map[string]int{"any": 1, "rust": 1}},
+		{id: "2", schedule: map[string]interface{}{"monday": true, "friday": true}, streams: map[string]int{"rust": 2}},
+		{id: "3", schedule: everyDay, streams: map[string]int{"any": 1},
+			dayStreams: map[string]map[string]int{"sunday": {"data science": 1}}},
+		{id: "4", schedule: weekdays, streams: map[string]int{"math": 0}},
+	}
+
+	var got []string
+	for _, topic := range listTopics(recursers) {
+		got = append(got, topic.String())
+	}
+	wanted := []string{
+		"`any`: 2 people, on Mondays, Tuesdays, Wednesdays, Thursdays, Fridays and Saturdays",
+		"`rust`: 2 people, on Mondays, Tuesdays, Wednesdays, Thursdays and Fridays",
+		"`data science`: 1 person, on Sundays",
+	}
+	if strings.Join(got, "\n") != strings.Join(wanted, "\n") {
+		t.Errorf("got\n%v\nwanted\n%v\n", strings.Join(got, "\n"), strings.Join(wanted, "\n"))
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recursers who haven't set a time zone are treated as being at RC
+const defaultTimezone = "America/New_York"
+
+// loading a time zone reads the tz database every time, and the matcher
+// needs them a lot, so they're kept around once loaded
+var locations sync.Map
+
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// location gets a recurser's time zone, falling back to the default one
+func (r *Recurser) location() *time.Location {
+	if r.timezone != "" {
+		if loc, err := loadLocation(r.timezone); err == nil {
+			return loc
+		}
+	}
+	loc, err := loadLocation(defaultTimezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// localPairingDay is the day, in the recurser's own time zone, that a
+// matching run at the given time is for. That's whichever local day is
+// nearest to its start: at 04:00 UTC it's the day that just started in New
+// York, the day about to start in Los Angeles, and tomorrow in Tokyo (whose
+// today is already half over).
+// The result is midnight at the start of that day, in the recurser's zone.
+func (r *Recurser) localPairingDay(now time.Time) time.Time {
+	local := now.In(r.location()).Add(12 * time.Hour)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+}
+
+// runDate is the date (YYYY-MM-DD) of the matching run that's for the given
+// local pairing day of the recurser's. That's the day before for people east
+// of about UTC+8, and the day itself for everyone else
+func (r *Recurser) runDate(day time.Time) string {
+	for _, offset := range []int{-1, 0, 1} {
+		run := time.Date(day.Year(), day.Month(), day.Day()+offset, matchHourUTC, 0, 0, 0, time.UTC)
+		if r.localPairingDay(run).Format(dateLayout) == day.Format(dateLayout) {
+			return run.Format(dateLayout)
+		}
+	}
+	return day.Format(dateLayout)
+}
+
+// todaysRunDate is the date of the matching run that was for the recurser's
+// own local day at the given time. Unlike localPairingDay, this is about what
+// day it is for them now, not the day a run starting now is for
+func (r *Recurser) todaysRunDate(now time.Time) string {
+	local := now.In(r.location())
+	return r.runDate(time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location()))
+}
+
+// isScheduledOn says whether a matching run at the given time should match
+// the recurser, going by the weekdays in their schedule
+func (r *Recurser) isScheduledOn(now time.Time) bool {
+	day := strings.ToLower(r.localPairingDay(now).Weekday().String())
+	scheduled, _ := r.schedule[day].(bool)
+	return scheduled
+}
+
+// streamsOn gets the streams, and their order, that a recurser wants on the
+// given weekday ("monday"): the ones they set for that day, or their usual ones
+func (r *Recurser) streamsOn(weekday string) (map[string]int, []string) {
+	if streams, ok := r.dayStreams[weekday]; ok {
+		return streams, r.dayStreamOrder[weekday]
+	}
+	return r.streams, r.streamOrder
+}
+
+// onDay is a copy of the recurser with the streams they want on the day a
+// matching run at the given time is for
+func (r Recurser) onDay(now time.Time) Recurser {
+	day := strings.ToLower(r.localPairingDay(now).Weekday().String())
+	r.streams, r.streamOrder = r.streamsOn(day)
+	return r
+}
+
+// findTimezone looks up a time zone name like America/Los_Angeles. Zone names
+// are case-sensitive, so if the name doesn't work as typed, this tries again
+// with each word capitalized (america/los_angeles -> America/Los_Angeles).
+// It returns the canonical name, or false if there's no such zone
+func findTimezone(name string) (string, bool) {
+	candidates := []string{name, strings.ToUpper(name)}
+
+	capitalized := []rune(strings.ToLower(name))
+	for i := range capitalized {
+		if i == 0 || strings.ContainsRune("/_-", capitalized[i-1]) {
+			capitalized[i] = []rune(strings.ToUpper(string(capitalized[i])))[0]
+		}
+	}
+	candidates = append(candidates, string(capitalized))
+
+	for _, candidate := range candidates {
+		// LoadLocation treats "" and "Local" specially, and neither is a real zone
+		if candidate == "" || strings.EqualFold(candidate, "local") {
+			continue
+		}
+		if _, err := time.LoadLocation(candidate); err == nil {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// parseHours parses a daily window like 10:00-16:00 (or just 10-16) into
+// minutes after midnight. A window that ends before it starts, like
+// 22:00-02:00, goes past midnight, but only written out as 24-hour times
+// like that: 9-5 almost always means 9am to 5pm, not 20 hours
+func parseHours(s string) (start, end int, ok bool) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	if start, ok = parseClock(parts[0]); !ok {
+		return 0, 0, false
+	}
+	if end, ok = parseClock(parts[1]); !ok {
+		return 0, 0, false
+	}
+	if end < start && !(is24Hour(parts[0]) && is24Hour(parts[1])) {
+		return 0, 0, false
+	}
+	return start, end, start != end
+}
+
+// is24Hour says whether a time is written like 02:00, which is how
+// people write 24-hour times
+func is24Hour(s string) bool {
+	return len(s) == len("15:04") && s[2] == ':'
+}
+
+// parseClock parses a time of day like 9, 09:30 or 24:00 into minutes after midnight
+func parseClock(s string) (int, bool) {
+	parts := strings.Split(s, ":")
+	if len(parts) > 2 {
+		return 0, false
+	}
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, false
+	}
+	minutes := 0
+	if len(parts) == 2 {
+		if len(parts[1]) != 2 {
+			return 0, false
+		}
+		if minutes, err = strconv.Atoi(parts[1]); err != nil {
+			return 0, false
+		}
+	}
+	if hours < 0 || minutes < 0 || minutes > 59 || hours*60+minutes > 24*60 {
+		return 0, false
+	}
+	return hours*60 + minutes, true
+}
+
+// availability is when the recurser is free on the day a run at the given
+// time is for. People who haven't set `hours` are free all day
+func (r *Recurser) availability(now time.Time) (time.Time, time.Time) {
+	day := r.localPairingDay(now)
+	start, end, ok := parseHours(r.hours)
+	if !ok {
+		return day, day.AddDate(0, 0, 1)
+	}
+	if end < start {
+		end += 24 * 60
+	}
+	// time.Date normalizes minutes past 59, and gets days with a DST change right
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, start, 0, 0, day.Location()),
+		time.Date(day.Year(), day.Month(), day.Day(), 0, end, 0, 0, day.Location())
+}
+
+// sharedWindow is when everyone in recursers is free. If they never are,
+// end is not after start
+func sharedWindow(recursers []Recurser, now time.Time) (start, end time.Time) {
+	for i, r := range recursers {
+		rStart, rEnd := r.availability(now)
+		if i == 0 || rStart.After(start) {
+			start = rStart
+		}
+		if i == 0 || rEnd.Before(end) {
+			end = rEnd
+		}
+	}
+	return start, end
+}
+
+// formatWindow shows the group's shared window in each of their time zones,
+// like "10:00-12:00 America/New_York, 07:00-09:00 America/Los_Angeles"
+func formatWindow(recursers []Recurser, now time.Time) string {
+	start, end := sharedWindow(recursers, now)
+	var zones []string
+	for _, r := range recursers {
+		loc := r.location()
+		zone := fmt.Sprintf("%v-%v %v", start.In(loc).Format("15:04"), end.In(loc).Format("15:04"), loc)
+		if !contains(zones, zone) {
+			zones = append(zones, zone)
+		}
+	}
+	return strings.Join(zones, ", ")
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocalPairingDay(t *testing.T) {
+	// matches go out at 04:00 UTC
+	run := time.Date(2026, time.October, 14, 4, 0, 0, 0, time.UTC)
+
+	var tableLocalPairingDay = []struct {
+		timezone string
+		wanted   string
+	}{
+		{"", "2026-10-14"},
+		{"America/New_York", "2026-10-14"},
+		{"America/Los_Angeles", "2026-10-14"},
+		{"Europe/Berlin", "2026-10-14"},
+		{"Asia/Tokyo", "2026-10-15"},
+		{"Pacific/Kiritimati", "2026-10-15"},
+		{"Pacific/Honolulu", "2026-10-14"},
+	}
+	for _, tt := range tableLocalPairingDay {
+		r := Recurser{timezone: tt.timezone}
+		if got := r.localPairingDay(run).Format(dateLayout); got != tt.wanted {
+			t.Errorf("timezone %q: got %v, wanted %v\n", tt.timezone, got, tt.wanted)
+		}
+	}
+}
+
+func TestFindTimezone(t *testing.T) {
+	var tableFindTimezone = []struct {
+		input  string
+		wanted string
+		ok     bool
+	}{
+		{"America/Los_Angeles", "America/Los_Angeles", true},
+		{"america/los_angeles", "America/Los_Angeles", true},
+		{"utc", "UTC", true},
+		{"europe/berlin", "Europe/Berlin", true},
+		{"Mars/Olympus_Mons", "", false},
+		{"local", "", false},
+	}
+	for _, tt := range tableFindTimezone {
+		got, ok := findTimezone(tt.input)
+		if got != tt.wanted || ok != tt.ok {
+			t.Errorf("findTimezone(%q) got %q, %v, wanted %q, %v\n", tt.input, got, ok, tt.wanted, tt.ok)
+		}
+	}
+}
+
+func TestSharedWindow(t *testing.T) {
+	run := time.Date(2026, time.October, 14, 4, 0, 0, 0, time.UTC)
+	newYork := Recurser{timezone: "America/New_York", hours: "10:00-16:00"}
+	losAngeles := Recurser{timezone: "America/Los_Angeles", hours: "9-17"}
+	allDay := Recurser{timezone: "Europe/Berlin"}
+	lateNight := Recurser{timezone: "America/New_York", hours: "22:00-02:00"}
+
+	var tableSharedWindow = []struct {
+		testName  string
+		recursers []Recurser
+		wanted    time.Duration
+	}{
+		{"new_york_and_los_angeles", []Recurser{newYork, losAngeles}, 4 * time.Hour},
+		{"all_day", []Recurser{newYork, allDay}, 6 * time.Hour},
+		{"no_overlap", []Recurser{newYork, lateNight}, 0},
+		{"past_midnight", []Recurser{lateNight, lateNight}, 4 * time.Hour},
+	}
+	for _, tt := range tableSharedWindow {
+		start, end := sharedWindow(tt.recursers, run)
+		got := end.Sub(start)
+		if got < 0 {
+			got = 0
+		}
+		if got != tt.wanted {
+			t.Errorf("%v: got %v, wanted %v\n", tt.testName, got, tt.wanted)
+		}
+	}
+}
+
+func TestOnDay(t *testing.T) {
+	r := Recurser{
+		timezone:       "Asia/Tokyo",
+		streams:        map[string]int{"any": 1},
+		streamOrder:    []string{"any"},
+		dayStreams:     map[string]map[string]int{"thursday": {"rust": 2}},
+		dayStreamOrder: map[string][]string{"thursday": {"rust"}},
+	}
+
+	// a wednesday in New York, but already thursday in Tokyo
+	run := time.Date(2026, time.October, 14, 4, 0, 0, 0, time.UTC)
+	if got := r.onDay(run); got.streams["rust"] != 2 || got.streams["any"] != 0 || got.streamOrder[0] != "rust" {
+		t.Errorf("got %v %v on thursday, wanted rust 2\n", got.streams, got.streamOrder)
+	}
+	if got := r.onDay(run.AddDate(0, 0, 1)); got.streams["any"] != 1 || got.streams["rust"] != 0 {
+		t.Errorf("got %v on friday, wanted the usual any 1\n", got.streams)
+	}
+	if r.streams["rust"] != 0 {
+		t.Errorf("onDay changed the recurser's usual streams to %v\n", r.streams)
+	}
+}
+
+func TestDueForFeedback(t *testing.T) {
+	record := matchRecord{date: "2026-10-19"}
+
+	var tableDueForFeedback = []struct {
+		timezone string
+		now      time.Time
+		wanted   bool
+	}{
+		// 20:30 on the 19th in New York
+		{"America/New_York", time.Date(2026, 10, 20, 0, 30, 0, 0, time.UTC), true},
+		{"America/New_York", time.Date(2026, 10, 19, 23, 30, 0, 0, time.UTC), false},
+		// 20:30 on the 19th in Los Angeles
+		{"America/Los_Angeles", time.Date(2026, 10, 20, 3, 30, 0, 0, time.UTC), true},
+		// the run on the 19th was for the 20th in Tokyo, so 08:00 on the 20th is too early
+		{"Asia/Tokyo", time.Date(2026, 10, 19, 23, 0, 0, 0, time.UTC), false},
+		{"Asia/Tokyo", time.Date(2026, 10, 20, 11, 0, 0, 0, time.UTC), true},
+		{"Asia/Tokyo", time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC), false},
+	}
+	for _, tt := range tableDueForFeedback {
+		r := Recurser{timezone: tt.timezone}
+		if got := r.dueForFeedback(record, tt.now); got != tt.wanted {
+			t.Errorf("timezone %q at %v: got %v, wanted %v\n", tt.timezone, tt.now, got, tt.wanted)
+		}
+	}
+}